@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/LerianStudio/lib-commons/v5/commons"
+)
+
+var (
+	// ErrInvalidTokenRequest matches TokenErrors for malformed requests (400), e.g. an unknown scope.
+	ErrInvalidTokenRequest = errors.New("invalid token request")
+	// ErrInvalidClient matches TokenErrors for rejected client credentials or refresh tokens (401).
+	ErrInvalidClient = errors.New("invalid client credentials")
+	// ErrTokenForbidden matches TokenErrors for clients not allowed the requested grant or scope (403).
+	ErrTokenForbidden = errors.New("token request forbidden")
+)
+
+// ApplicationToken is a token issued by the auth service's token endpoint.
+// ExpiresAt is computed from ExpiresIn when the response is received; it is zero when the
+// token was issued without an expiry.
+type ApplicationToken struct {
+	AccessToken  string
+	IDToken      string
+	TokenType    string
+	ExpiresIn    int
+	ExpiresAt    time.Time
+	RefreshToken string
+	Scope        string
+}
+
+// Expired reports whether the token expires within leeway from now. Tokens without an expiry never expire.
+func (t *ApplicationToken) Expired(leeway time.Duration) bool {
+	return !t.ExpiresAt.IsZero() && !time.Now().Add(leeway).Before(t.ExpiresAt)
+}
+
+// newApplicationToken converts the wire representation, computing ExpiresAt relative to receivedAt.
+func newApplicationToken(wire oauth2Token, receivedAt time.Time) *ApplicationToken {
+	token := &ApplicationToken{
+		AccessToken:  wire.AccessToken,
+		TokenType:    wire.TokenType,
+		ExpiresIn:    wire.ExpiresIn,
+		RefreshToken: wire.RefreshToken,
+	}
+
+	if wire.IDToken != nil {
+		token.IDToken = *wire.IDToken
+	}
+
+	if wire.Scope != nil {
+		token.Scope = *wire.Scope
+	}
+
+	if wire.ExpiresIn > 0 {
+		token.ExpiresAt = receivedAt.Add(time.Duration(wire.ExpiresIn) * time.Second)
+	}
+
+	return token
+}
+
+// TokenError is returned when the token endpoint rejects a request. It matches ErrInvalidTokenRequest,
+// ErrInvalidClient or ErrTokenForbidden with errors.Is, and unwraps to the auth service's commons.Response.
+type TokenError struct {
+	StatusCode int
+	Response   commons.Response
+}
+
+func (e *TokenError) Error() string {
+	return fmt.Sprintf("token request failed with status %d: %s", e.StatusCode, e.Response.Message)
+}
+
+func (e *TokenError) Unwrap() error {
+	return e.Response
+}
+
+func (e *TokenError) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest:
+		return target == ErrInvalidTokenRequest
+	case http.StatusUnauthorized:
+		return target == ErrInvalidClient
+	case http.StatusForbidden:
+		return target == ErrTokenForbidden
+	default:
+		return false
+	}
+}
@@ -0,0 +1,298 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/LerianStudio/lib-commons/v5/commons"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// ---------------------------------------------------------------------------
+// GetApplicationTokenResponse
+// ---------------------------------------------------------------------------
+
+func TestGetApplicationTokenResponse_FullResponse(t *testing.T) {
+	t.Parallel()
+
+	idToken := "id-token"
+	scope := "ledgers:read ledgers:write"
+
+	var capturedBody map[string]string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&capturedBody))
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(oauth2Token{
+			AccessToken:  "access-token",
+			IDToken:      &idToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    3600,
+			RefreshToken: "refresh-token",
+			Scope:        &scope,
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	auth := tokenClient(server.URL)
+
+	before := time.Now()
+
+	token, err := auth.GetApplicationTokenResponse(context.Background(), "client", "secret", "ledgers:read", "ledgers:write")
+	require.NoError(t, err)
+
+	assert.Equal(t, "access-token", token.AccessToken)
+	assert.Equal(t, "id-token", token.IDToken)
+	assert.Equal(t, "Bearer", token.TokenType)
+	assert.Equal(t, 3600, token.ExpiresIn)
+	assert.Equal(t, "refresh-token", token.RefreshToken)
+	assert.Equal(t, scope, token.Scope)
+	assert.WithinRange(t, token.ExpiresAt, before.Add(time.Hour), time.Now().Add(time.Hour))
+	assert.False(t, token.Expired(time.Minute))
+	assert.True(t, token.Expired(2*time.Hour))
+
+	assert.Equal(t, map[string]string{
+		"grantType":    "client_credentials",
+		"clientId":     "client",
+		"clientSecret": "secret",
+		"scope":        "ledgers:read ledgers:write",
+	}, capturedBody)
+}
+
+func TestGetApplicationTokenResponse_WithoutExpiry(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.NotContains(t, body, "scope")
+
+		_ = json.NewEncoder(w).Encode(oauth2Token{AccessToken: "access-token"})
+	}))
+	t.Cleanup(server.Close)
+
+	token, err := tokenClient(server.URL).GetApplicationTokenResponse(context.Background(), "client", "secret")
+	require.NoError(t, err)
+
+	assert.True(t, token.ExpiresAt.IsZero())
+	assert.False(t, token.Expired(time.Hour))
+}
+
+func TestGetApplicationTokenResponse_TokenError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		statusCode int
+		target     error
+	}{
+		{name: "400_invalid_request", statusCode: http.StatusBadRequest, target: ErrInvalidTokenRequest},
+		{name: "401_invalid_client", statusCode: http.StatusUnauthorized, target: ErrInvalidClient},
+		{name: "403_forbidden", statusCode: http.StatusForbidden, target: ErrTokenForbidden},
+		{name: "500_is_not_a_token", statusCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.statusCode)
+				_, _ = w.Write([]byte(`{"code":"AUT-0001","title":"Rejected","message":"request rejected"}`))
+			}))
+			t.Cleanup(server.Close)
+
+			token, err := tokenClient(server.URL).GetApplicationTokenResponse(context.Background(), "client", "secret")
+			require.Error(t, err)
+			assert.Nil(t, token)
+
+			var tokenErr *TokenError
+			require.ErrorAs(t, err, &tokenErr)
+			assert.Equal(t, tt.statusCode, tokenErr.StatusCode)
+
+			var response commons.Response
+			require.ErrorAs(t, err, &response)
+			assert.Equal(t, "request rejected", response.Message)
+
+			if tt.target != nil {
+				assert.ErrorIs(t, err, tt.target)
+			}
+
+			for _, other := range []error{ErrInvalidTokenRequest, ErrInvalidClient, ErrTokenForbidden} {
+				if other != tt.target {
+					assert.NotErrorIs(t, err, other)
+				}
+			}
+		})
+	}
+}
+
+func TestGetApplicationTokenResponse_DisabledClient(t *testing.T) {
+	t.Parallel()
+
+	auth := NewAuthClientWithOptions("http://plugin-auth:4000", WithEnabled(false), WithLogger(&testLogger{}))
+
+	token, err := auth.GetApplicationTokenResponse(context.Background(), "client", "secret")
+	require.NoError(t, err)
+	require.NotNil(t, token)
+	assert.Empty(t, token.AccessToken)
+}
+
+// ---------------------------------------------------------------------------
+// RefreshApplicationToken
+// ---------------------------------------------------------------------------
+
+func TestRefreshApplicationToken(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { require.NoError(t, tp.Shutdown(context.Background())) })
+
+	var capturedBody map[string]string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/login/oauth/access_token", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&capturedBody))
+
+		_ = json.NewEncoder(w).Encode(oauth2Token{AccessToken: "new-access-token", ExpiresIn: 60, RefreshToken: "new-refresh-token"})
+	}))
+	t.Cleanup(server.Close)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}), WithTracerProvider(tp))
+
+	token, err := auth.RefreshApplicationToken(context.Background(), "client", "secret", "old-refresh-token")
+	require.NoError(t, err)
+	assert.Equal(t, "new-access-token", token.AccessToken)
+	assert.Equal(t, "new-refresh-token", token.RefreshToken)
+
+	assert.Equal(t, map[string]string{
+		"grantType":    "refresh_token",
+		"clientId":     "client",
+		"clientSecret": "secret",
+		"refreshToken": "old-refresh-token",
+	}, capturedBody)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "lib_auth.refresh_application_token", spans[0].Name)
+
+	for _, attr := range spans[0].Attributes {
+		assert.NotContains(t, attr.Value.Emit(), "secret")
+		assert.NotContains(t, attr.Value.Emit(), "old-refresh-token")
+	}
+}
+
+func TestRefreshApplicationToken_Rejected(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"code":401,"title":"Unauthorized","message":"refresh token expired"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	_, err := tokenClient(server.URL).RefreshApplicationToken(context.Background(), "client", "secret", "expired")
+	require.ErrorIs(t, err, ErrInvalidClient)
+}
+
+// ---------------------------------------------------------------------------
+// RevokeToken
+// ---------------------------------------------------------------------------
+
+func TestRevokeToken(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		tokenTypeHint string
+		wantBody      map[string]string
+	}{
+		{
+			name:     "without_hint",
+			wantBody: map[string]string{"clientId": "client", "clientSecret": "secret", "token": "user-token"},
+		},
+		{
+			name:          "with_hint",
+			tokenTypeHint: "refresh_token",
+			wantBody:      map[string]string{"clientId": "client", "clientSecret": "secret", "token": "user-token", "tokenTypeHint": "refresh_token"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var capturedBody map[string]string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/v1/login/oauth/revoke", r.URL.Path)
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&capturedBody))
+
+				w.WriteHeader(http.StatusOK)
+			}))
+			t.Cleanup(server.Close)
+
+			err := tokenClient(server.URL).RevokeToken(context.Background(), "client", "secret", "user-token", tt.tokenTypeHint)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBody, capturedBody)
+		})
+	}
+}
+
+func TestRevokeToken_Rejected(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"code":"AUT-0401","title":"Unauthorized","message":"invalid client"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	err := tokenClient(server.URL).RevokeToken(context.Background(), "client", "wrong", "user-token", "")
+
+	var tokenErr *TokenError
+	require.ErrorAs(t, err, &tokenErr)
+	assert.Equal(t, http.StatusUnauthorized, tokenErr.StatusCode)
+	assert.ErrorIs(t, err, ErrInvalidClient)
+}
+
+func TestRevokeToken_PurgesCachedDecisions(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	auth := NewAuthClientWithOptions(server.URL,
+		WithHealthCheck(false),
+		WithLogger(&testLogger{}),
+		WithDecisionCache(DecisionCacheConfig{}),
+	)
+
+	revoked := newDecisionKey("acme/user1", "midaz", "ledgers", "get", "revoked-token")
+	other := newDecisionKey("acme/user1", "midaz", "ledgers", "get", "other-token")
+
+	auth.DecisionCache.set(revoked, true, time.Time{})
+	auth.DecisionCache.set(newDecisionKey("acme/user1", "midaz", "ledgers", "post", "revoked-token"), true, time.Time{})
+	auth.DecisionCache.set(other, true, time.Time{})
+
+	require.NoError(t, auth.RevokeToken(context.Background(), "client", "secret", "revoked-token", "access_token"))
+
+	_, ok := auth.DecisionCache.get(revoked)
+	assert.False(t, ok)
+
+	_, ok = auth.DecisionCache.get(other)
+	assert.True(t, ok)
+	assert.Equal(t, 1, auth.DecisionCache.Len())
+}
@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/LerianStudio/lib-observability/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Request asks whether Principal may perform Action on Resource within Product.
+type Request struct {
+	Principal *Principal
+	Product   string
+	Resource  string
+	Action    string
+
+	// Token is the raw access token, for authorizers that forward it to an authority.
+	Token string
+}
+
+// Decision is an Authorizer's answer to a Request.
+type Decision struct {
+	Authorized bool
+
+	// StatusCode is the HTTP status of the authority that decided, when there is one. With an
+	// error, 500 or above (or no status at all) means the authorizer is unavailable and the
+	// DegradationPolicy applies; lower statuses are returned to the caller as is.
+	StatusCode int
+}
+
+// Authorizer decides authorization requests. Authorize, CheckBatch and the gRPC policy
+// interceptors ask the AuthClient's Authorizer after authenticating the token; the decision
+// cache, request coalescing and degradation policy apply to any implementation. Only the auth
+// service checks that a token is genuine, so with an Authorizer other than RemoteAuthorizer the
+// AuthClient needs a Verifier: without one, Request.Principal would come from an unverified token
+// and requests fail with 500 instead.
+type Authorizer interface {
+	Check(ctx context.Context, req Request) (Decision, error)
+}
+
+// AuthorizerFunc adapts a function to an Authorizer, e.g. to decorate another Authorizer.
+type AuthorizerFunc func(ctx context.Context, req Request) (Decision, error)
+
+// Check calls f.
+func (f AuthorizerFunc) Check(ctx context.Context, req Request) (Decision, error) {
+	return f(ctx, req)
+}
+
+// AllOf authorizes a request only when every authorizer does, asking them in order and stopping
+// at the first denial or error. With no authorizers, requests are denied.
+func AllOf(authorizers ...Authorizer) Authorizer {
+	return AuthorizerFunc(func(ctx context.Context, req Request) (Decision, error) {
+		decision := Decision{StatusCode: http.StatusOK}
+
+		for _, authorizer := range authorizers {
+			var err error
+
+			decision, err = authorizer.Check(ctx, req)
+			if err != nil || !decision.Authorized {
+				return decision, err
+			}
+		}
+
+		decision.Authorized = len(authorizers) > 0
+
+		return decision, nil
+	})
+}
+
+// AnyOf authorizes a request as soon as one authorizer does, asking them in order. When none
+// does, the first error is returned, if any, so that the DegradationPolicy can apply. With no
+// authorizers, requests are denied.
+func AnyOf(authorizers ...Authorizer) Authorizer {
+	return AuthorizerFunc(func(ctx context.Context, req Request) (Decision, error) {
+		var (
+			denied   = Decision{StatusCode: http.StatusOK}
+			firstErr error
+			errored  Decision
+		)
+
+		for _, authorizer := range authorizers {
+			decision, err := authorizer.Check(ctx, req)
+
+			switch {
+			case err != nil:
+				if firstErr == nil {
+					firstErr, errored = err, decision
+				}
+			case decision.Authorized:
+				return decision, nil
+			default:
+				denied = decision
+			}
+		}
+
+		if firstErr != nil {
+			return errored, firstErr
+		}
+
+		return denied, nil
+	})
+}
+
+// RemoteAuthorizer returns the Authorizer asking the auth service's /v1/authorize, which the
+// client uses when its Authorizer is nil. It is meant to be composed with other authorizers,
+// e.g. AnyOf(localEngine, auth.RemoteAuthorizer()).
+func (auth *AuthClient) RemoteAuthorizer() Authorizer {
+	return remoteAuthorizer{auth: auth}
+}
+
+type remoteAuthorizer struct {
+	auth *AuthClient
+}
+
+// Check performs the POST to /v1/authorize for req. The product is only forwarded for normal
+// users, so that the auth service can isolate their permissions by product. Requests without a
+// Principal are denied.
+func (r remoteAuthorizer) Check(ctx context.Context, req Request) (Decision, error) {
+	if req.Principal == nil {
+		return Decision{StatusCode: http.StatusOK}, nil
+	}
+
+	span := trace.SpanFromContext(ctx)
+
+	requestBody := map[string]string{
+		"sub":      req.Principal.Subject,
+		"resource": req.Resource,
+		"action":   req.Action,
+	}
+
+	if req.Principal.IsNormalUser() && req.Product != "" {
+		requestBody["product"] = req.Product
+	}
+
+	if err := tracing.SetSpanAttributesFromValue(span, "app.request.payload", requestBody, nil); err != nil {
+		tracing.HandleSpanError(span, "Failed to convert request body to JSON string", err)
+
+		return Decision{StatusCode: http.StatusInternalServerError}, err
+	}
+
+	authorized, statusCode, err := r.auth.requestAuthorization(ctx, span, requestBody, req.Token)
+
+	return Decision{Authorized: authorized, StatusCode: statusCode}, err
+}
+
+// authorizer returns the client's Authorizer, defaulting to the auth service.
+func (auth *AuthClient) authorizer() Authorizer {
+	if auth.Authorizer != nil {
+		return auth.Authorizer
+	}
+
+	return auth.RemoteAuthorizer()
+}
+
+// remoteAuthority reports whether the auth service decides every check, and so vouches for the
+// tokens when they are not verified locally.
+func (auth *AuthClient) remoteAuthority() bool {
+	switch auth.Authorizer.(type) {
+	case nil, remoteAuthorizer:
+		return true
+	default:
+		return false
+	}
+}
+
+// enforcing reports whether checks apply: the client is enabled and decisions come from the auth
+// service or from an Authorizer.
+func (auth *AuthClient) enforcing() bool {
+	return auth.Enabled && (auth.Address != "" || auth.Authorizer != nil)
+}
@@ -0,0 +1,323 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeAuthorizer answers every request with decision and err, recording the requests it receives.
+type fakeAuthorizer struct {
+	decision Decision
+	err      error
+
+	mu       sync.Mutex
+	requests []Request
+}
+
+func (f *fakeAuthorizer) Check(_ context.Context, req Request) (Decision, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, req)
+
+	return f.decision, f.err
+}
+
+func (f *fakeAuthorizer) calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.requests)
+}
+
+var (
+	allow = &fakeAuthorizer{decision: Decision{Authorized: true}}
+	deny  = &fakeAuthorizer{decision: Decision{StatusCode: http.StatusOK}}
+	down  = &fakeAuthorizer{decision: Decision{StatusCode: http.StatusServiceUnavailable}, err: errors.New("engine unavailable")}
+)
+
+// ---------------------------------------------------------------------------
+// AllOf / AnyOf
+// ---------------------------------------------------------------------------
+
+func TestAuthorizerChains(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		authorizer     Authorizer
+		wantAuthorized bool
+		wantErr        bool
+	}{
+		{name: "all_of_authorized", authorizer: AllOf(allow, allow), wantAuthorized: true},
+		{name: "all_of_denied", authorizer: AllOf(allow, deny)},
+		{name: "all_of_error", authorizer: AllOf(allow, down), wantErr: true},
+		{name: "all_of_stops_at_denial", authorizer: AllOf(deny, down)},
+		{name: "all_of_empty", authorizer: AllOf()},
+		{name: "any_of_authorized", authorizer: AnyOf(deny, allow), wantAuthorized: true},
+		{name: "any_of_authorized_despite_error", authorizer: AnyOf(down, allow), wantAuthorized: true},
+		{name: "any_of_denied", authorizer: AnyOf(deny, deny)},
+		{name: "any_of_error", authorizer: AnyOf(deny, down), wantErr: true},
+		{name: "any_of_empty", authorizer: AnyOf()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			decision, err := tt.authorizer.Check(context.Background(), Request{Resource: "ledgers", Action: "get"})
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Equal(t, http.StatusServiceUnavailable, decision.StatusCode)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAuthorized, decision.Authorized)
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Authorize with an Authorizer
+// ---------------------------------------------------------------------------
+
+func TestAuthorize_WithAuthorizer(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeAuthorizer{decision: Decision{Authorized: true}}
+
+	verifier, sign := newTestVerifier(t)
+	token := sign(userClaims())
+
+	// No address: the Authorizer alone decides.
+	auth := NewAuthClientWithOptions("", WithLogger(&testLogger{}), WithAuthorizer(fake))
+	auth.Verifier = verifier
+
+	app := fiber.New()
+	app.Get("/ledgers", auth.Authorize("midaz", "ledgers", "get"), func(c *fiber.Ctx) error {
+		principal, ok := PrincipalFromFiber(c)
+		require.True(t, ok)
+		assert.Equal(t, "acme/user1", principal.Subject)
+
+		return c.SendStatus(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/ledgers", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 1, fake.calls())
+
+	got := fake.requests[0]
+	assert.Equal(t, "acme/user1", got.Principal.Subject)
+	assert.Equal(t, "midaz", got.Product)
+	assert.Equal(t, "ledgers", got.Resource)
+	assert.Equal(t, "get", got.Action)
+	assert.Equal(t, token, got.Token)
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/ledgers", nil))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestAuthorize_AuthorizerWithoutVerifier(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeAuthorizer{decision: Decision{Authorized: true}}
+
+	auth := NewAuthClientWithOptions("", WithLogger(&testLogger{}), WithAuthorizer(fake))
+
+	app := fiber.New()
+	app.Get("/ledgers", auth.Authorize("midaz", "ledgers", "get"), func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+
+	// Signed with the attacker's own key: the Authorizer must not see its claims.
+	req := httptest.NewRequest(http.MethodGet, "/ledgers", nil)
+	req.Header.Set("Authorization", "Bearer "+createTestJWT(userClaims()))
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, 0, fake.calls())
+
+	_, err = auth.CheckBatch(context.Background(), createTestJWT(userClaims()), "midaz", batchPolicies[:1])
+	require.ErrorIs(t, err, ErrVerifierRequired)
+
+	// RemoteAuthorizer keeps the auth service as the authority.
+	server := newAuthServer(t)
+
+	remote := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+	remote.Authorizer = remote.RemoteAuthorizer()
+
+	authorized, _, err := remote.checkAuthorization(context.Background(), "midaz", "ledgers", "get", createTestJWT(userClaims()))
+	require.NoError(t, err)
+	assert.True(t, authorized)
+	assert.Equal(t, int32(1), server.calls.Load())
+}
+
+func TestAuthorize_AuthorizerOutcomes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		authorizer  *fakeAuthorizer
+		degradation DegradationPolicy
+		wantStatus  int
+	}{
+		{name: "denied", authorizer: &fakeAuthorizer{}, wantStatus: http.StatusForbidden},
+		{name: "client_error", authorizer: &fakeAuthorizer{decision: Decision{StatusCode: http.StatusBadRequest}, err: errors.New("bad request")}, wantStatus: http.StatusBadRequest},
+		{name: "error_without_status", authorizer: &fakeAuthorizer{err: errors.New("boom")}, wantStatus: http.StatusInternalServerError},
+		{name: "unavailable_fail_open", authorizer: &fakeAuthorizer{err: errors.New("boom")}, degradation: DegradationPolicy{Mode: FailOpen}, wantStatus: http.StatusOK},
+	}
+
+	verifier, sign := newTestVerifier(t)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			auth := NewAuthClientWithOptions("", WithLogger(&testLogger{}), WithAuthorizer(tt.authorizer), WithDegradation(tt.degradation))
+			auth.Verifier = verifier
+
+			app := fiber.New()
+			app.Get("/ledgers", auth.Authorize("midaz", "ledgers", "get"), func(c *fiber.Ctx) error {
+				return c.SendStatus(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/ledgers", nil)
+			req.Header.Set("Authorization", "Bearer "+sign(userClaims()))
+
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestAuthorize_DecisionCacheWrapsAuthorizer(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeAuthorizer{decision: Decision{Authorized: true}}
+
+	verifier, sign := newTestVerifier(t)
+	token := sign(userClaims())
+
+	auth := NewAuthClientWithOptions("", WithLogger(&testLogger{}), WithAuthorizer(fake), WithDecisionCache(DecisionCacheConfig{}))
+	auth.Verifier = verifier
+
+	for range 3 {
+		authorized, statusCode, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+		require.NoError(t, err)
+		assert.True(t, authorized)
+		assert.Equal(t, http.StatusOK, statusCode)
+	}
+
+	assert.Equal(t, 1, fake.calls())
+}
+
+func TestRemoteAuthorizer_Composed(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+
+	var decorated atomic.Int32
+
+	verifier, sign := newTestVerifier(t)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+	auth.Verifier = verifier
+	remote := auth.RemoteAuthorizer()
+	auth.Authorizer = AnyOf(deny, AuthorizerFunc(func(ctx context.Context, req Request) (Decision, error) {
+		decorated.Add(1)
+
+		return remote.Check(ctx, req)
+	}))
+
+	authorized, _, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", sign(userClaims()))
+	require.NoError(t, err)
+	assert.True(t, authorized)
+	assert.Equal(t, int32(1), decorated.Load())
+	assert.Equal(t, int32(1), server.calls.Load())
+}
+
+func TestRemoteAuthorizer_NilPrincipal(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+
+	decision, err := auth.RemoteAuthorizer().Check(context.Background(), Request{Resource: "ledgers", Action: "get"})
+	require.NoError(t, err)
+	assert.False(t, decision.Authorized)
+	assert.Equal(t, int32(0), server.calls.Load())
+}
+
+// ---------------------------------------------------------------------------
+// gRPC and CheckBatch with an Authorizer
+// ---------------------------------------------------------------------------
+
+func TestGRPCPolicy_WithAuthorizer(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeAuthorizer{}
+
+	verifier, sign := newTestVerifier(t)
+
+	auth := NewAuthClientWithOptions("", WithLogger(&testLogger{}), WithAuthorizer(fake))
+	auth.Verifier = verifier
+	cfg := PolicyConfig{DefaultPolicy: &Policy{Resource: "ledgers", Action: "get"}}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+sign(userClaims())))
+
+	_, err := NewGRPCAuthUnaryPolicy(auth, cfg)(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Get"}, func(context.Context, any) (any, error) {
+		return "ok", nil
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, 1, fake.calls())
+}
+
+func TestCheckBatch_WithAuthorizer(t *testing.T) {
+	t.Parallel()
+
+	server := newBatchServer(t, 0)
+
+	fake := &fakeAuthorizer{decision: Decision{Authorized: true}}
+
+	verifier, sign := newTestVerifier(t)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}), WithAuthorizer(fake))
+	auth.Verifier = verifier
+
+	decisions, err := auth.CheckBatch(context.Background(), sign(userClaims()), "midaz", batchPolicies[:3])
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true, true}, decisions)
+	assert.Equal(t, 3, fake.calls())
+	assert.Equal(t, int32(0), server.batches.Load())
+}
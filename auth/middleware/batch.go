@@ -0,0 +1,358 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/LerianStudio/lib-observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultBatchConcurrency = 8
+
+	// batchRetryInterval is how long CheckBatch checks policies individually after the auth service
+	// answered that it has no batch endpoint, before trying it again.
+	batchRetryInterval = 5 * time.Minute
+)
+
+// errBatchUnsupported is returned by requestBatch when the auth service has no batch endpoint.
+var errBatchUnsupported = errors.New("batch authorization is not supported by the auth service")
+
+// ErrBatchResourceTemplate is returned by CheckBatch for policies whose resource is a template such
+// as "ledgers/:id": there is no request to resolve it from.
+var ErrBatchResourceTemplate = errors.New("resource templates are not supported by CheckBatch")
+
+// AuthError is returned by CheckBatch when a check fails rather than being denied, e.g. for an
+// invalid token (401) or an unavailable auth service (5xx). StatusCode is the HTTP status
+// Authorize would have answered with; Err unwraps to the cause.
+type AuthError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("authorization failed with status %d: %v", e.StatusCode, e.Err)
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// Permission identifies a resource/action pair, e.g. in a batch authorization request or an RBACRole grant.
+type Permission struct {
+	Resource string `json:"resource" yaml:"resource"`
+	Action   string `json:"action" yaml:"action"`
+}
+
+type batchItem struct {
+	Resource   string `json:"resource"`
+	Action     string `json:"action"`
+	Authorized bool   `json:"authorized,omitempty"`
+}
+
+type batchResponse struct {
+	Results []batchItem `json:"results"`
+}
+
+// CheckBatch reports which policies accessToken satisfies, e.g. to render the actions a user may
+// perform: decisions[i] is the decision for policies[i]. Each resource and action is decided once;
+// the Scopes, Claims and Condition of each policy then apply to its own decision only.
+// Cached decisions are reused and the others are requested in a single call to
+// /v1/authorize/batch. When the auth service has no batch endpoint, policies are checked
+// individually with bounded concurrency (WithBatchConcurrency) for the next five minutes, as they
+// always are with a custom Authorizer. While the auth service is unavailable, each policy's
+// Degradation applies; policies sharing a resource and action get the strictest of theirs.
+// Resources must be concrete: templates fail with ErrBatchResourceTemplate. Scopes, Claims and
+// Condition are checked locally, as in the gRPC interceptors, with no request attributes; policies
+// with only those fail with ErrVerifierRequired when the client has no Verifier. Checks that fail
+// rather than deny, e.g. for an invalid token, are returned as *AuthError. Disabled clients
+// authorize every policy.
+func (auth *AuthClient) CheckBatch(ctx context.Context, accessToken, product string, policies []Policy) ([]bool, error) {
+	tracer, reqID := auth.tracking(ctx)
+
+	ctx, span := tracer.Start(ctx, "lib_auth.check_batch")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("app.request.request_id", reqID),
+		attribute.Int("app.auth.batch.size", len(policies)),
+	)
+
+	for _, pol := range policies {
+		if isResourceTemplate(pol.Resource) {
+			return nil, fmt.Errorf("%w: %s", ErrBatchResourceTemplate, pol.Resource)
+		}
+	}
+
+	decisions := make([]bool, len(policies))
+
+	if !auth.enforcing() {
+		for i := range decisions {
+			decisions[i] = true
+		}
+
+		return decisions, nil
+	}
+
+	if auth.Verifier == nil && slices.ContainsFunc(policies, Policy.localOnly) {
+		logErrorf(ctx, auth.Logger, "Local authorization check without a Verifier: configure WithJWKS")
+
+		tracing.HandleSpanError(span, "Local authorization check without a Verifier", ErrVerifierRequired)
+
+		return nil, ErrVerifierRequired
+	}
+
+	if auth.Authorizer != nil || time.Now().UnixNano() < auth.batchRetryAt.Load() {
+		return auth.checkEach(ctx, accessToken, product, policies)
+	}
+
+	principal, statusCode, err := auth.authenticate(ctx, span, product, accessToken)
+	if err != nil {
+		return nil, &AuthError{StatusCode: statusCode, Err: err}
+	}
+
+	remote := make(map[Permission]bool, len(policies))
+
+	// degradations holds the DegradationPolicy of each remote permission, the strictest when
+	// policies sharing it disagree.
+	degradations := make(map[Permission]DegradationPolicy, len(policies))
+
+	var pending []Permission
+
+	for _, pol := range policies {
+		perm := Permission{Resource: pol.Resource, Action: pol.Action}
+
+		if pol.localOnly() {
+			continue
+		}
+
+		degradation := auth.Degradation
+		if pol.Degradation != nil {
+			degradation = *pol.Degradation
+		}
+
+		if prev, seen := degradations[perm]; seen {
+			degradation = prev.stricter(degradation)
+		}
+
+		degradations[perm] = degradation
+
+		if _, done := remote[perm]; done {
+			continue
+		}
+
+		if auth.DecisionCache != nil {
+			if authorized, hit := auth.DecisionCache.get(newDecisionKey(principal.Subject, product, perm.Resource, perm.Action, accessToken)); hit {
+				remote[perm] = authorized
+
+				continue
+			}
+		}
+
+		// Marked as pending so duplicates are requested once.
+		remote[perm] = false
+		pending = append(pending, perm)
+	}
+
+	span.SetAttributes(attribute.Int("app.auth.batch.pending", len(pending)))
+
+	if len(pending) > 0 {
+		results, statusCode, err := auth.requestBatch(ctx, span, principal, product, pending, accessToken)
+
+		switch {
+		case errors.Is(err, errBatchUnsupported):
+			auth.batchRetryAt.Store(time.Now().Add(batchRetryInterval).UnixNano())
+
+			logWarnf(ctx, auth.Logger, "%s has no batch authorization endpoint, checking policies individually for %s", pluginName, batchRetryInterval)
+
+			return auth.checkEach(ctx, accessToken, product, policies)
+		case err != nil && statusCode >= http.StatusInternalServerError:
+			for _, perm := range pending {
+				degradation := degradations[perm]
+
+				authorized, ok := auth.degrade(ctx, span, &degradation, newDecisionKey(principal.Subject, product, perm.Resource, perm.Action, accessToken))
+				if !ok {
+					return nil, &AuthError{StatusCode: statusCode, Err: err}
+				}
+
+				remote[perm] = authorized
+			}
+		case err != nil:
+			return nil, &AuthError{StatusCode: statusCode, Err: err}
+		default:
+			for _, perm := range pending {
+				remote[perm] = results[perm]
+
+				if auth.DecisionCache != nil {
+					auth.DecisionCache.set(newDecisionKey(principal.Subject, product, perm.Resource, perm.Action, accessToken), results[perm], tokenExpiry(principal.Claims))
+				}
+			}
+		}
+	}
+
+	for i, pol := range policies {
+		authorized := (pol.localOnly() || remote[Permission{Resource: pol.Resource, Action: pol.Action}]) && principal.satisfies(pol.Scopes, pol.Claims)
+
+		if authorized {
+			met, err := auth.meetsCondition(ctx, pol.Condition, principal, nil)
+			if err != nil {
+				return nil, err
+			}
+
+			authorized = met
+		}
+
+		decisions[i] = authorized
+	}
+
+	return decisions, nil
+}
+
+// checkEach checks policies individually, at most WithBatchConcurrency at a time.
+func (auth *AuthClient) checkEach(ctx context.Context, accessToken, product string, policies []Policy) ([]bool, error) {
+	concurrency := auth.batchConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	decisions := make([]bool, len(policies))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+
+	for i, pol := range policies {
+		g.Go(func() error {
+			_, authorized, statusCode, err := auth.authorizePolicy(gctx, product, pol, accessToken, nil)
+			if err != nil {
+				return &AuthError{StatusCode: statusCode, Err: err}
+			}
+
+			decisions[i] = authorized
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return decisions, nil
+}
+
+// requestBatch performs the POST to /v1/authorize/batch for principal and returns the decision
+// of each permission; permissions missing from the response are denied. It returns
+// errBatchUnsupported when the endpoint does not exist.
+func (auth *AuthClient) requestBatch(ctx context.Context, span trace.Span, principal *Principal, product string, perms []Permission, accessToken string) (map[Permission]bool, int, error) {
+	items := make([]batchItem, len(perms))
+	for i, perm := range perms {
+		items[i] = batchItem{Resource: perm.Resource, Action: perm.Action}
+	}
+
+	requestBody := map[string]any{
+		"sub":      principal.Subject,
+		"requests": items,
+	}
+
+	if principal.IsNormalUser() && product != "" {
+		requestBody["product"] = product
+	}
+
+	if err := tracing.SetSpanAttributesFromValue(span, "app.request.payload", requestBody, nil); err != nil {
+		tracing.HandleSpanError(span, "Failed to convert request body to JSON string", err)
+
+		return nil, http.StatusInternalServerError, err
+	}
+
+	requestBodyJSON, err := json.Marshal(requestBody)
+	if err != nil {
+		logErrorf(ctx, auth.Logger, "Failed to marshal request body: %v", err)
+
+		tracing.HandleSpanError(span, "Failed to marshal request body", err)
+
+		return nil, http.StatusInternalServerError, err
+	}
+
+	req, err := auth.newRequest(ctx, http.MethodPost, fmt.Sprintf("%s/v1/authorize/batch", auth.Address), bytes.NewBuffer(requestBodyJSON))
+	if err != nil {
+		logErrorf(ctx, auth.Logger, "Failed to create request: %v", err)
+
+		tracing.HandleSpanError(span, "Failed to create request", err)
+
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	tracing.InjectHTTPContext(ctx, req.Header)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", accessToken)
+
+	resp, err := auth.do(span, req)
+	if err != nil {
+		logErrorf(ctx, auth.Logger, "Failed to make request: %v", err)
+
+		tracing.HandleSpanError(span, "Failed to make request", err)
+
+		if errors.Is(err, ErrCircuitOpen) {
+			return nil, http.StatusServiceUnavailable, err
+		}
+
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, resp.StatusCode, errBatchUnsupported
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logErrorf(ctx, auth.Logger, "Failed to read response body: %v", err)
+
+		tracing.HandleSpanError(span, "Failed to read response body", err)
+
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		err := fmt.Errorf("batch authorization failed with status %d", resp.StatusCode)
+
+		if respError, uErr := unmarshalErrorResponse(body); uErr == nil && respError.Code != "" {
+			err = respError
+		}
+
+		logErrorf(ctx, auth.Logger, "Batch authorization request failed: %v", err)
+
+		tracing.HandleSpanError(span, "Batch authorization request failed", err)
+
+		return nil, resp.StatusCode, err
+	}
+
+	var response batchResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		logErrorf(ctx, auth.Logger, "Failed to unmarshal batch response: %v", err)
+
+		tracing.HandleSpanError(span, "Failed to unmarshal batch response", err)
+
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to unmarshal batch response: %w", err)
+	}
+
+	results := make(map[Permission]bool, len(perms))
+
+	for _, item := range response.Results {
+		results[Permission{Resource: item.Resource, Action: item.Action}] = item.Authorized
+	}
+
+	return results, resp.StatusCode, nil
+}
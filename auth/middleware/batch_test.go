@@ -0,0 +1,350 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchServer authorizes the resource/action pairs in allowed, through the batch endpoint unless
+// batchStatus is set, and through /v1/authorize. It records request counts and the peak number of
+// concurrent single checks.
+type batchServer struct {
+	*httptest.Server
+
+	allowed     map[Permission]bool
+	batchStatus int
+
+	batches  atomic.Int32
+	singles  atomic.Int32
+	inflight atomic.Int32
+	peak     atomic.Int32
+	lastBody atomic.Value
+}
+
+func newBatchServer(t *testing.T, batchStatus int, allowed ...Permission) *batchServer {
+	t.Helper()
+
+	bs := &batchServer{allowed: map[Permission]bool{}, batchStatus: batchStatus}
+	for _, perm := range allowed {
+		bs.allowed[perm] = true
+	}
+
+	bs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Path == "/v1/authorize/batch" {
+			bs.batches.Add(1)
+
+			if bs.batchStatus != 0 {
+				w.WriteHeader(bs.batchStatus)
+
+				return
+			}
+
+			var body struct {
+				Sub      string      `json:"sub"`
+				Product  string      `json:"product"`
+				Requests []batchItem `json:"requests"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("batch server: request must carry its body: %v", err)
+			}
+
+			bs.lastBody.Store(body.Requests)
+
+			assert.Equal(t, "acme/user1", body.Sub)
+			assert.Equal(t, "midaz", body.Product)
+
+			var resp batchResponse
+			for _, item := range body.Requests {
+				item.Authorized = bs.allowed[Permission{Resource: item.Resource, Action: item.Action}]
+				resp.Results = append(resp.Results, item)
+			}
+
+			_ = json.NewEncoder(w).Encode(resp)
+
+			return
+		}
+
+		bs.singles.Add(1)
+
+		if n := bs.inflight.Add(1); n > bs.peak.Load() {
+			bs.peak.Store(n)
+		}
+		defer bs.inflight.Add(-1)
+
+		time.Sleep(10 * time.Millisecond)
+
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("batch server: request must carry its body: %v", err)
+		}
+
+		_ = json.NewEncoder(w).Encode(AuthResponse{Authorized: bs.allowed[Permission{Resource: body["resource"], Action: body["action"]}]})
+	}))
+	t.Cleanup(bs.Close)
+
+	return bs
+}
+
+var batchPolicies = []Policy{
+	{Resource: "ledgers", Action: "get"},
+	{Resource: "ledgers", Action: "post"},
+	{Resource: "accounts", Action: "get"},
+	{Resource: "accounts", Action: "get"}, // duplicates are requested once
+	{Resource: "reports", Action: "get", Scopes: []string{"reports:write"}},
+}
+
+// ---------------------------------------------------------------------------
+// CheckBatch
+// ---------------------------------------------------------------------------
+
+func TestCheckBatch(t *testing.T) {
+	t.Parallel()
+
+	server := newBatchServer(t, 0,
+		Permission{Resource: "ledgers", Action: "get"},
+		Permission{Resource: "accounts", Action: "get"},
+		Permission{Resource: "reports", Action: "get"},
+	)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}), WithDecisionCache(DecisionCacheConfig{}))
+
+	// reports/get is authorized remotely, but the token lacks the scope.
+	want := []bool{true, false, true, true, false}
+
+	decisions, err := auth.CheckBatch(context.Background(), createTestJWT(userClaims()), "midaz", batchPolicies)
+	require.NoError(t, err)
+	assert.Equal(t, want, decisions)
+	assert.Equal(t, int32(1), server.batches.Load())
+	assert.Equal(t, int32(0), server.singles.Load())
+	assert.Len(t, server.lastBody.Load(), 4)
+
+	decisions, err = auth.CheckBatch(context.Background(), createTestJWT(userClaims()), "midaz", batchPolicies)
+	require.NoError(t, err)
+	assert.Equal(t, want, decisions)
+	assert.Equal(t, int32(1), server.batches.Load(), "cached decisions must not be requested again")
+
+	// Decisions cached by the batch are shared with single checks.
+	authorized, _, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", createTestJWT(userClaims()))
+	require.NoError(t, err)
+	assert.True(t, authorized)
+	assert.Equal(t, int32(0), server.singles.Load())
+}
+
+func TestCheckBatch_WithoutBatchEndpoint(t *testing.T) {
+	t.Parallel()
+
+	server := newBatchServer(t, http.StatusNotFound,
+		Permission{Resource: "ledgers", Action: "get"},
+		Permission{Resource: "accounts", Action: "get"},
+		Permission{Resource: "reports", Action: "get"},
+	)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}), WithBatchConcurrency(2))
+
+	policies := append([]Policy{}, batchPolicies...)
+	for i := range 6 {
+		policies = append(policies, Policy{Resource: "extra", Action: string(rune('a' + i))})
+	}
+
+	for range 2 {
+		decisions, err := auth.CheckBatch(context.Background(), createTestJWT(userClaims()), "midaz", policies)
+		require.NoError(t, err)
+
+		require.Len(t, decisions, 11)
+		assert.Equal(t, []bool{true, false, true, true, false}, decisions[:5])
+	}
+
+	assert.Equal(t, int32(1), server.batches.Load(), "the missing batch endpoint must be remembered")
+	assert.LessOrEqual(t, server.peak.Load(), int32(2))
+
+	// A 404 may come from a proxy: the endpoint is tried again once the retry interval elapsed.
+	auth.batchRetryAt.Store(time.Now().Add(-time.Second).UnixNano())
+
+	_, err := auth.CheckBatch(context.Background(), createTestJWT(userClaims()), "midaz", policies)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), server.batches.Load())
+}
+
+func TestCheckBatch_AuthServiceUnavailable(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		mode    FailureMode
+		wantErr bool
+	}{
+		{name: "fail_closed", mode: FailClosed, wantErr: true},
+		{name: "fail_open", mode: FailOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newBatchServer(t, http.StatusServiceUnavailable)
+
+			verifier, sign := newTestVerifier(t)
+
+			auth := NewAuthClientWithOptions(server.URL,
+				WithHealthCheck(false),
+				WithLogger(&testLogger{}),
+				WithDegradation(DegradationPolicy{Mode: tt.mode}),
+			)
+			auth.Verifier = verifier
+
+			decisions, err := auth.CheckBatch(context.Background(), sign(userClaims()), "midaz", batchPolicies[:2])
+			if tt.wantErr {
+				var authErr *AuthError
+				require.ErrorAs(t, err, &authErr)
+				assert.Equal(t, http.StatusServiceUnavailable, authErr.StatusCode)
+				assert.Nil(t, decisions)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, []bool{true, true}, decisions)
+			assert.Equal(t, int32(0), server.singles.Load())
+		})
+	}
+}
+
+func TestCheckBatch_PolicyDegradation(t *testing.T) {
+	t.Parallel()
+
+	failClosed := &DegradationPolicy{Mode: FailClosed}
+
+	tests := []struct {
+		name     string
+		policies []Policy
+	}{
+		{
+			name: "fail_closed_policy",
+			policies: []Policy{
+				{Resource: "ledgers", Action: "get"},
+				{Resource: "ledgers", Action: "post", Degradation: failClosed},
+			},
+		},
+		{
+			name: "strictest_of_duplicates",
+			policies: []Policy{
+				{Resource: "ledgers", Action: "get"},
+				{Resource: "ledgers", Action: "get", Degradation: failClosed},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newBatchServer(t, http.StatusServiceUnavailable)
+
+			verifier, sign := newTestVerifier(t)
+
+			auth := NewAuthClientWithOptions(server.URL,
+				WithHealthCheck(false),
+				WithLogger(&testLogger{}),
+				WithDegradation(DegradationPolicy{Mode: FailOpen}),
+			)
+			auth.Verifier = verifier
+
+			decisions, err := auth.CheckBatch(context.Background(), sign(userClaims()), "midaz", tt.policies)
+			require.Error(t, err)
+			assert.Nil(t, decisions)
+			assert.Equal(t, int32(0), server.singles.Load())
+		})
+	}
+}
+
+func TestCheckBatch_InvalidToken(t *testing.T) {
+	t.Parallel()
+
+	server := newBatchServer(t, 0)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+
+	_, err := auth.CheckBatch(context.Background(), "not-a-jwt", "midaz", batchPolicies)
+
+	var authErr *AuthError
+	require.ErrorAs(t, err, &authErr)
+	assert.Equal(t, http.StatusUnauthorized, authErr.StatusCode)
+	assert.Equal(t, int32(0), server.batches.Load())
+}
+
+func TestCheckBatch_ResourceTemplate(t *testing.T) {
+	t.Parallel()
+
+	server := newBatchServer(t, 0)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+
+	_, err := auth.CheckBatch(context.Background(), createTestJWT(userClaims()), "midaz", []Policy{{Resource: "ledgers/:id", Action: "get"}})
+	require.ErrorIs(t, err, ErrBatchResourceTemplate)
+	assert.Equal(t, int32(0), server.batches.Load())
+}
+
+func TestCheckBatch_LocalOnlyPolicies(t *testing.T) {
+	t.Parallel()
+
+	server := newBatchServer(t, 0, Permission{Resource: "ledgers", Action: "get"})
+
+	policies := []Policy{{Resource: "ledgers", Action: "get"}, {Scopes: []string{"reports:read"}}}
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+
+	_, err := auth.CheckBatch(context.Background(), createTestJWT(userClaims()), "midaz", policies)
+	require.ErrorIs(t, err, ErrVerifierRequired)
+	assert.Equal(t, int32(0), server.batches.Load())
+
+	verifier, sign := newTestVerifier(t)
+	auth.Verifier = verifier
+
+	decisions, err := auth.CheckBatch(context.Background(), sign(jwt.MapClaims{"type": "normal-user", "owner": "acme", "sub": "user1", "scope": "reports:read"}), "midaz", policies)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true}, decisions)
+}
+
+func TestCheckBatch_DecisionsPerPolicy(t *testing.T) {
+	t.Parallel()
+
+	server := newBatchServer(t, 0, Permission{Resource: "ledgers", Action: "get"})
+
+	verifier, sign := newTestVerifier(t)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+	auth.Verifier = verifier
+
+	policies := []Policy{
+		{Resource: "ledgers", Action: "get", Scopes: []string{"ledgers:write"}},
+		{Resource: "ledgers", Action: "get", Scopes: []string{"ledgers:read"}},
+		{Scopes: []string{"reports:read"}},
+		{Scopes: []string{"ledgers:read"}},
+	}
+
+	decisions, err := auth.CheckBatch(context.Background(), sign(userClaims()), "midaz", policies)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{false, true, false, true}, decisions)
+	assert.Len(t, server.lastBody.Load(), 1)
+}
+
+func TestCheckBatch_DisabledClient(t *testing.T) {
+	t.Parallel()
+
+	auth := NewAuthClientWithOptions("http://plugin-auth:4000", WithEnabled(false), WithLogger(&testLogger{}))
+
+	decisions, err := auth.CheckBatch(context.Background(), "", "midaz", batchPolicies[:2])
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true}, decisions)
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/sony/gobreaker"
+)
+
+const (
+	defaultBreakerFailureRatio = 0.5
+	defaultBreakerMinRequests  = 10
+	defaultBreakerInterval     = 60 * time.Second
+	defaultBreakerCoolDown     = 30 * time.Second
+	defaultBreakerHalfOpenMax  = 1
+)
+
+// ErrCircuitOpen is returned, without contacting the auth service, while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("auth service circuit breaker is open")
+
+// CircuitState is the state of the auth service circuit breaker.
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open"
+	// CircuitDisabled is reported when no circuit breaker is configured.
+	CircuitDisabled CircuitState = "disabled"
+)
+
+// CircuitBreakerConfig configures the circuit breaker around the auth service.
+// - FailureRatio trips the breaker when failed/total requests reaches it (default 0.5)...
+// - ...once at least MinRequests were made in the current Interval (defaults 10 and 60s).
+// - CoolDown is how long the breaker stays open before letting probes through (default 30s).
+// - HalfOpenMaxRequests is the number of probes allowed while half-open (default 1).
+// While open, authorization checks follow the client's DegradationPolicy.
+// Network errors and 5xx responses count as failures; 4xx responses are decisions and count as successes.
+type CircuitBreakerConfig struct {
+	FailureRatio        float64
+	MinRequests         uint32
+	Interval            time.Duration
+	CoolDown            time.Duration
+	HalfOpenMaxRequests uint32
+}
+
+// circuitBreaker classifies auth service responses for the underlying breaker.
+type circuitBreaker struct {
+	cb *gobreaker.TwoStepCircuitBreaker
+}
+
+// newCircuitBreaker builds the breaker, logging every state transition through auth.Logger.
+func (auth *AuthClient) newCircuitBreaker(cfg CircuitBreakerConfig) *circuitBreaker {
+	if cfg.FailureRatio <= 0 || cfg.FailureRatio > 1 {
+		cfg.FailureRatio = defaultBreakerFailureRatio
+	}
+
+	if cfg.MinRequests == 0 {
+		cfg.MinRequests = defaultBreakerMinRequests
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultBreakerInterval
+	}
+
+	if cfg.CoolDown <= 0 {
+		cfg.CoolDown = defaultBreakerCoolDown
+	}
+
+	if cfg.HalfOpenMaxRequests == 0 {
+		cfg.HalfOpenMaxRequests = defaultBreakerHalfOpenMax
+	}
+
+	settings := gobreaker.Settings{
+		Name:        pluginName,
+		MaxRequests: cfg.HalfOpenMaxRequests,
+		Interval:    cfg.Interval,
+		Timeout:     cfg.CoolDown,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.Requests >= cfg.MinRequests &&
+				float64(counts.TotalFailures)/float64(counts.Requests) >= cfg.FailureRatio
+		},
+		OnStateChange: func(name string, from, to gobreaker.State) {
+			msg := "Circuit breaker for %s changed from %s to %s"
+			if to == gobreaker.StateOpen {
+				logErrorf(context.Background(), auth.Logger, msg, name, circuitStateOf(from), circuitStateOf(to))
+
+				return
+			}
+
+			logWarnf(context.Background(), auth.Logger, msg, name, circuitStateOf(from), circuitStateOf(to))
+		},
+	}
+
+	return &circuitBreaker{cb: gobreaker.NewTwoStepCircuitBreaker(settings)}
+}
+
+// allow reserves a slot for one call to the auth service. It returns ErrCircuitOpen when the
+// breaker is open or its half-open probe budget is exhausted.
+func (b *circuitBreaker) allow() (func(resp *http.Response, err error), error) {
+	done, err := b.cb.Allow()
+	if err != nil {
+		return nil, ErrCircuitOpen
+	}
+
+	return func(resp *http.Response, err error) {
+		switch {
+		case errors.Is(err, context.Canceled):
+			// The caller gave up; that says nothing about the health of the auth service.
+			done(true)
+		case err != nil:
+			done(false)
+		default:
+			done(resp.StatusCode < http.StatusInternalServerError)
+		}
+	}, nil
+}
+
+func circuitStateOf(s gobreaker.State) CircuitState {
+	switch s {
+	case gobreaker.StateOpen:
+		return CircuitOpen
+	case gobreaker.StateHalfOpen:
+		return CircuitHalfOpen
+	default:
+		return CircuitClosed
+	}
+}
+
+// CircuitBreakerState returns the current state of the auth service circuit breaker,
+// or CircuitDisabled when none is configured.
+func (auth *AuthClient) CircuitBreakerState() CircuitState {
+	if auth.breaker == nil {
+		return CircuitDisabled
+	}
+
+	return circuitStateOf(auth.breaker.cb.State())
+}
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LerianStudio/lib-observability/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordingLogger keeps every logged message so tests can assert on them.
+type recordingLogger struct {
+	testLogger
+
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Log(_ context.Context, _ log.Level, msg string, _ ...log.Field) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.messages = append(l.messages, msg)
+}
+
+func (l *recordingLogger) contains(substr string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, msg := range l.messages {
+		if strings.Contains(msg, substr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func breakerClient(t *testing.T, address string, cfg CircuitBreakerConfig, opts ...Option) *AuthClient {
+	t.Helper()
+
+	opts = append([]Option{
+		WithHealthCheck(false),
+		WithLogger(&testLogger{}),
+		WithCircuitBreaker(cfg),
+	}, opts...)
+
+	return NewAuthClientWithOptions(address, opts...)
+}
+
+// ---------------------------------------------------------------------------
+// Circuit breaker
+// ---------------------------------------------------------------------------
+
+func TestCircuitBreaker_DisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	auth := NewAuthClientWithOptions("", WithHealthCheck(false), WithLogger(&testLogger{}))
+
+	assert.Equal(t, CircuitDisabled, auth.CircuitBreakerState())
+}
+
+func TestCircuitBreaker_OpensAndShortCircuits(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+	server.failFirst(100, http.StatusServiceUnavailable, nil)
+	logger := &recordingLogger{}
+
+	auth := breakerClient(t, server.URL, CircuitBreakerConfig{MinRequests: 3, CoolDown: time.Hour}, WithLogger(logger))
+	token := createTestJWT(userClaims())
+
+	assert.Equal(t, CircuitClosed, auth.CircuitBreakerState())
+
+	for range 3 {
+		_, statusCode, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusInternalServerError, statusCode)
+	}
+
+	assert.Equal(t, CircuitOpen, auth.CircuitBreakerState())
+	assert.True(t, logger.contains("changed from closed to open"))
+
+	authorized, statusCode, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	assert.False(t, authorized)
+	assert.Equal(t, http.StatusServiceUnavailable, statusCode)
+	assert.Equal(t, int32(3), server.calls.Load(), "an open breaker must not reach the auth service")
+}
+
+func TestCircuitBreaker_ClientErrorsDoNotTrip(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+	server.failFirst(100, http.StatusForbidden, nil)
+
+	auth := breakerClient(t, server.URL, CircuitBreakerConfig{MinRequests: 2})
+	token := createTestJWT(userClaims())
+
+	for range 5 {
+		_, _, _ = auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+	}
+
+	assert.Equal(t, CircuitClosed, auth.CircuitBreakerState())
+}
+
+func TestCircuitBreaker_HalfOpenProbeCloses(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+	server.failFirst(2, http.StatusServiceUnavailable, nil)
+
+	auth := breakerClient(t, server.URL, CircuitBreakerConfig{MinRequests: 2, CoolDown: 20 * time.Millisecond})
+	token := createTestJWT(userClaims())
+
+	for range 2 {
+		_, _, _ = auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+	}
+
+	require.Equal(t, CircuitOpen, auth.CircuitBreakerState())
+
+	require.Eventually(t, func() bool {
+		return auth.CircuitBreakerState() == CircuitHalfOpen
+	}, time.Second, 5*time.Millisecond)
+
+	authorized, statusCode, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+	require.NoError(t, err)
+	assert.True(t, authorized)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, CircuitClosed, auth.CircuitBreakerState())
+	assert.Equal(t, int32(3), server.calls.Load())
+}
+
+func TestCircuitBreaker_OpenFollowsDegradationPolicy(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+	server.failFirst(100, http.StatusServiceUnavailable, nil)
+	logger := &recordingLogger{}
+
+	verifier, sign := newTestVerifier(t)
+
+	auth := breakerClient(t, server.URL,
+		CircuitBreakerConfig{MinRequests: 1, CoolDown: time.Hour},
+		WithLogger(logger),
+		WithDegradation(DegradationPolicy{Mode: FailOpen}),
+	)
+	auth.Verifier = verifier
+	token := sign(userClaims())
+
+	authorized, statusCode, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+	require.NoError(t, err)
+	assert.True(t, authorized)
+	assert.Equal(t, http.StatusOK, statusCode)
+	require.Equal(t, CircuitOpen, auth.CircuitBreakerState())
+
+	authorized, statusCode, err = auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+	require.NoError(t, err)
+	assert.True(t, authorized)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, int32(1), server.calls.Load())
+	assert.True(t, logger.contains("failing open"))
+}
+
+func TestCircuitBreaker_SpanAttribute(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+	server.failFirst(100, http.StatusServiceUnavailable, nil)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { require.NoError(t, tp.Shutdown(context.Background())) })
+
+	auth := breakerClient(t, server.URL, CircuitBreakerConfig{MinRequests: 1, CoolDown: time.Hour}, WithTracerProvider(tp))
+	token := createTestJWT(userClaims())
+
+	for range 2 {
+		_, _, _ = auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+	}
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+
+	stateOf := func(span tracetest.SpanStub) attribute.Value {
+		for _, attr := range span.Attributes {
+			if attr.Key == "app.auth.circuit_breaker.state" {
+				return attr.Value
+			}
+		}
+
+		return attribute.Value{}
+	}
+
+	assert.Equal(t, string(CircuitClosed), stateOf(spans[0]).AsString())
+	assert.Equal(t, string(CircuitOpen), stateOf(spans[1]).AsString())
+}
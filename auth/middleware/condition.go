@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LerianStudio/lib-observability/tracing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/cel-go/cel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// ErrInvalidCondition is returned for conditions that do not compile or do not evaluate to a bool.
+var ErrInvalidCondition = errors.New("invalid authorization condition")
+
+var (
+	// conditionEnv declares the variables conditions are evaluated against.
+	conditionEnv = sync.OnceValues(func() (*cel.Env, error) {
+		return cel.NewEnv(
+			cel.Variable("claims", cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable("principal", cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable("now", cel.TimestampType),
+		)
+	})
+
+	// conditions caches compiled conditions by expression.
+	conditions sync.Map
+)
+
+// condition is a compiled CEL expression.
+type condition struct {
+	expr    string
+	program cel.Program
+}
+
+// WithCondition requires the CEL expression expr to evaluate to true, locally and after the
+// remote decision, for one route; e.g. `request.params.owner_id == principal.userId`. See
+// ValidateCondition for the available variables. Invalid expressions are logged when the route
+// is built and reject its requests with 500.
+func WithCondition(expr string) AuthorizeOption {
+	return func(c *authorizeConfig) {
+		c.condition = expr
+	}
+}
+
+// ValidateCondition compiles expr, e.g. to reject invalid conditions at startup. Conditions are CEL
+// expressions evaluating to a bool, with the variables:
+//   - claims: the token claims.
+//   - principal: subject, owner, userId, userType, tenantId, tenantSlug and scopes.
+//   - request: method, path, ip, params, query and headers for Fiber; method, ip, metadata and message for gRPC.
+//   - now: the evaluation time, as a timestamp.
+//
+// Header and metadata names are lower-case, and gRPC messages use proto field names.
+func ValidateCondition(expr string) error {
+	_, err := compileCondition(expr)
+
+	return err
+}
+
+func compileCondition(expr string) (*condition, error) {
+	if cached, ok := conditions.Load(expr); ok {
+		return cached.(*condition), nil
+	}
+
+	env, err := conditionEnv()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCondition, err)
+	}
+
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCondition, iss.Err())
+	}
+
+	if out := ast.OutputType(); !out.IsExactType(cel.BoolType) && !out.IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("%w: %q evaluates to %s, not bool", ErrInvalidCondition, expr, out)
+	}
+
+	program, err := env.Program(ast, cel.InterruptCheckFrequency(100))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCondition, err)
+	}
+
+	cached, _ := conditions.LoadOrStore(expr, &condition{expr: expr, program: program})
+
+	return cached.(*condition), nil
+}
+
+func (c *condition) eval(ctx context.Context, vars map[string]any) (bool, error) {
+	out, _, err := c.program.ContextEval(ctx, vars)
+	if err != nil {
+		return false, err
+	}
+
+	met, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: %q evaluated to %s, not bool", ErrInvalidCondition, c.expr, out.Type())
+	}
+
+	return met, nil
+}
+
+// meetsCondition reports whether p meets the condition expr for request; an empty expr always is.
+// Evaluation errors, such as a missing attribute, are reported as unmet, while invalid conditions
+// return an error.
+func (auth *AuthClient) meetsCondition(ctx context.Context, expr string, p *Principal, request map[string]any) (bool, error) {
+	if expr == "" {
+		return true, nil
+	}
+
+	span := trace.SpanFromContext(ctx)
+
+	cond, err := compileCondition(expr)
+	if err != nil {
+		logErrorf(ctx, auth.Logger, "Invalid authorization condition: %v", err)
+
+		tracing.HandleSpanError(span, "Invalid authorization condition", err)
+
+		return false, err
+	}
+
+	met, err := cond.eval(ctx, conditionVars(p, request))
+	if err != nil {
+		logWarnf(ctx, auth.Logger, "Failed to evaluate authorization condition %q: %v", expr, err)
+
+		met = false
+	}
+
+	span.SetAttributes(attribute.Bool("app.auth.condition.met", met))
+
+	return met, nil
+}
+
+func conditionVars(p *Principal, request map[string]any) map[string]any {
+	claims := map[string]any(p.Claims)
+	if claims == nil {
+		claims = map[string]any{}
+	}
+
+	if request == nil {
+		request = map[string]any{}
+	}
+
+	return map[string]any{
+		"claims": claims,
+		"principal": map[string]any{
+			"subject":    p.Subject,
+			"owner":      p.Owner,
+			"userId":     p.UserID,
+			"userType":   p.UserType,
+			"tenantId":   p.TenantID,
+			"tenantSlug": p.TenantSlug,
+			"scopes":     p.Scopes,
+		},
+		"request": request,
+		"now":     time.Now(),
+	}
+}
+
+// fiberConditionRequest returns the request attributes of c for conditions.
+func fiberConditionRequest(c *fiber.Ctx) map[string]any {
+	headers := make(map[string]string)
+
+	for name, values := range c.GetReqHeaders() {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+
+	return map[string]any{
+		"method":  c.Method(),
+		"path":    c.Path(),
+		"ip":      c.IP(),
+		"params":  c.AllParams(),
+		"query":   c.Queries(),
+		"headers": headers,
+	}
+}
+
+// grpcConditionRequest returns the attributes of the RPC fullMethod for conditions. req is the
+// request message, nil for streams.
+func grpcConditionRequest(ctx context.Context, fullMethod string, req any) map[string]any {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	values := make(map[string]string, len(md))
+	for key, vals := range md {
+		values[key] = strings.Join(vals, ",")
+	}
+
+	request := map[string]any{
+		"method":   fullMethod,
+		"metadata": values,
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+
+		request["ip"] = host
+	}
+
+	if message := messageValues(req); message != nil {
+		request["message"] = message
+	}
+
+	return request
+}
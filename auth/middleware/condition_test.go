@@ -0,0 +1,224 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/typepb"
+)
+
+// ---------------------------------------------------------------------------
+// ValidateCondition
+// ---------------------------------------------------------------------------
+
+func TestValidateCondition(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{name: "comparison", expr: `claims.owner == "acme"`},
+		{name: "dynamic_value", expr: `request.message.approved`},
+		{name: "timestamp", expr: `now.getHours("UTC") >= 9 && now.getHours("UTC") < 18`},
+		{name: "syntax_error", expr: `claims.owner ==`, wantErr: true},
+		{name: "unknown_variable", expr: `user.owner == "acme"`, wantErr: true},
+		{name: "not_a_bool", expr: `principal.subject + "/x"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := ValidateCondition(tt.expr)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidCondition)
+
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// meetsCondition
+// ---------------------------------------------------------------------------
+
+func TestMeetsCondition(t *testing.T) {
+	t.Parallel()
+
+	auth := &AuthClient{Logger: &testLogger{}}
+
+	p := newPrincipal(jwt.MapClaims{
+		"type": "normal-user", "owner": "acme", "sub": "user1", "level": float64(3), "scope": "ledgers:read",
+	}, "acme/user1")
+
+	request := map[string]any{
+		"params":  map[string]string{"owner_id": "user1"},
+		"headers": map[string]string{"x-channel": "web"},
+		"message": map[string]any{"amount": int64(500), "status": "PENDING"},
+	}
+
+	tests := []struct {
+		name    string
+		expr    string
+		want    bool
+		wantErr bool
+	}{
+		{name: "empty", want: true},
+		{name: "record_owner", expr: `request.params.owner_id == principal.userId`, want: true},
+		{name: "header", expr: `request.headers["x-channel"] == "mobile"`},
+		{name: "amount_below_limit", expr: `request.message.amount < 1000 && request.message.status == "PENDING"`, want: true},
+		{name: "numeric_claim", expr: `claims.level >= 3`, want: true},
+		{name: "scopes", expr: `"ledgers:read" in principal.scopes`, want: true},
+		{name: "environment", expr: `now > timestamp("2000-01-01T00:00:00Z")`, want: true},
+		{name: "missing_attribute_is_unmet", expr: `request.query.limit == "10"`},
+		{name: "non_bool_result_is_unmet", expr: `request.message.status`},
+		{name: "invalid", expr: `request.params.owner_id ==`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			met, err := auth.meetsCondition(context.Background(), tt.expr, p, request)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidCondition)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, met)
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Authorize WithCondition
+// ---------------------------------------------------------------------------
+
+func TestAuthorize_WithCondition(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) }
+
+	app := fiber.New()
+	app.Get("/users/:owner_id/ledgers", auth.Authorize("midaz", "ledgers", "get", WithCondition(`request.params.owner_id == principal.userId`)), ok)
+	app.Post("/transfers", auth.Authorize("midaz", "transfers", "post", WithCondition(`int(request.query.amount) <= 1000 && request.headers["x-channel"] == "web"`)), ok)
+	app.Get("/broken", auth.Authorize("midaz", "ledgers", "get", WithCondition(`request.params ==`)), ok)
+
+	tests := []struct {
+		method     string
+		target     string
+		channel    string
+		wantStatus int
+	}{
+		{method: http.MethodGet, target: "/users/user1/ledgers", wantStatus: http.StatusOK},
+		{method: http.MethodGet, target: "/users/user2/ledgers", wantStatus: http.StatusForbidden},
+		{method: http.MethodPost, target: "/transfers?amount=900", channel: "web", wantStatus: http.StatusOK},
+		{method: http.MethodPost, target: "/transfers?amount=1500", channel: "web", wantStatus: http.StatusForbidden},
+		{method: http.MethodPost, target: "/transfers?amount=900", channel: "mobile", wantStatus: http.StatusForbidden},
+		{method: http.MethodPost, target: "/transfers", channel: "web", wantStatus: http.StatusForbidden},
+		{method: http.MethodGet, target: "/broken", wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		req.Header.Set("Authorization", "Bearer "+createTestJWT(userClaims()))
+
+		if tt.channel != "" {
+			req.Header.Set("X-Channel", tt.channel)
+		}
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		assert.Equal(t, tt.wantStatus, resp.StatusCode, tt.target)
+	}
+
+	assert.Equal(t, int32(len(tests)), server.calls.Load(), "conditions are evaluated after the remote decision")
+}
+
+// ---------------------------------------------------------------------------
+// gRPC policies with a Condition
+// ---------------------------------------------------------------------------
+
+func TestGRPCPolicy_Condition(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		policy    Policy
+		req       any
+		wantCode  codes.Code
+		wantCalls int32
+	}{
+		{
+			name:      "message_field_met",
+			policy:    Policy{Resource: "fields", Action: "post", Condition: `request.message.number < 10 && request.message.kind == "TYPE_STRING"`},
+			req:       &typepb.Field{Number: 7, Kind: typepb.Field_TYPE_STRING},
+			wantCode:  codes.OK,
+			wantCalls: 1,
+		},
+		{
+			name:      "message_field_unmet",
+			policy:    Policy{Resource: "fields", Action: "post", Condition: `request.message.number < 10`},
+			req:       &typepb.Field{Number: 12},
+			wantCode:  codes.PermissionDenied,
+			wantCalls: 1,
+		},
+		{
+			name:     "local_only",
+			policy:   Policy{Condition: `request.metadata["x-channel"] == "web" && request.method == "/pkg.Fields/Create"`},
+			req:      &typepb.Field{},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "invalid",
+			policy:   Policy{Condition: `request.message.number <`},
+			req:      &typepb.Field{},
+			wantCode: codes.Internal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newAuthServer(t)
+
+			verifier, sign := newTestVerifier(t)
+
+			auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+			auth.Verifier = verifier
+			cfg := PolicyConfig{DefaultPolicy: &tt.policy}
+
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+sign(userClaims()), "x-channel", "web"))
+
+			_, err := NewGRPCAuthUnaryPolicy(auth, cfg)(ctx, tt.req, &grpc.UnaryServerInfo{FullMethod: "/pkg.Fields/Create"}, func(context.Context, any) (any, error) {
+				return "ok", nil
+			})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			assert.Equal(t, tt.wantCalls, server.calls.Load())
+		})
+	}
+}
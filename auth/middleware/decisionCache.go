@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDecisionCachePositiveTTL = 30 * time.Second
+	defaultDecisionCacheNegativeTTL = 5 * time.Second
+	defaultDecisionCacheMaxEntries  = 10000
+)
+
+// DecisionCacheConfig configures the in-memory authorization decision cache.
+// - PositiveTTL is how long an "authorized" decision is reused (default 30s).
+// - NegativeTTL is how long a "not authorized" decision is reused (default 5s).
+// - MaxEntries bounds the cache size; least recently used entries are evicted first (default 10000).
+// Entries never outlive the token's "exp" claim.
+type DecisionCacheConfig struct {
+	PositiveTTL time.Duration
+	NegativeTTL time.Duration
+	MaxEntries  int
+}
+
+// DecisionCache is an LRU cache of authorization decisions keyed by subject, product,
+// resource, action and a hash of the access token. Safe for concurrent use.
+type DecisionCache struct {
+	cfg DecisionCacheConfig
+
+	mu      sync.Mutex
+	entries map[decisionKey]*list.Element
+	lru     *list.List
+}
+
+// decisionKey identifies a cached decision. The token is stored as a SHA-256 hash so raw
+// credentials are never retained in memory longer than the request.
+type decisionKey struct {
+	subject   string
+	product   string
+	resource  string
+	action    string
+	tokenHash string
+}
+
+// decisionEntry outlives its TTL until evicted, so FailStale can serve it as the last-known decision.
+type decisionEntry struct {
+	key        decisionKey
+	authorized bool
+	storedAt   time.Time
+	expiresAt  time.Time
+	tokenExp   time.Time
+}
+
+// NewDecisionCache creates a DecisionCache, applying defaults for zero-valued settings.
+func NewDecisionCache(cfg DecisionCacheConfig) *DecisionCache {
+	if cfg.PositiveTTL <= 0 {
+		cfg.PositiveTTL = defaultDecisionCachePositiveTTL
+	}
+
+	if cfg.NegativeTTL <= 0 {
+		cfg.NegativeTTL = defaultDecisionCacheNegativeTTL
+	}
+
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = defaultDecisionCacheMaxEntries
+	}
+
+	return &DecisionCache{
+		cfg:     cfg,
+		entries: make(map[decisionKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// newDecisionKey builds the cache key for an authorization check.
+func newDecisionKey(subject, product, resource, action, accessToken string) decisionKey {
+	return decisionKey{
+		subject:   subject,
+		product:   product,
+		resource:  resource,
+		action:    action,
+		tokenHash: hashToken(accessToken),
+	}
+}
+
+// hashToken returns the hex SHA-256 of accessToken used in decision keys.
+func hashToken(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// String encodes the key for use as an in-flight group key.
+func (k decisionKey) String() string {
+	return strings.Join([]string{k.subject, k.product, k.resource, k.action, k.tokenHash}, "\x00")
+}
+
+// get returns the cached decision for key when present and not expired.
+func (c *DecisionCache) get(key decisionKey) (authorized, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, found := c.entries[key]
+	if !found {
+		return false, false
+	}
+
+	entry := elem.Value.(*decisionEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		return false, false
+	}
+
+	c.lru.MoveToFront(elem)
+
+	return entry.authorized, true
+}
+
+// getStale returns the last-known decision for key, expired or not, when it was stored less
+// than maxStaleness ago and the token it was made for has not expired.
+func (c *DecisionCache) getStale(key decisionKey, maxStaleness time.Duration) (authorized, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, found := c.entries[key]
+	if !found {
+		return false, false
+	}
+
+	entry := elem.Value.(*decisionEntry)
+	now := time.Now()
+
+	if now.Sub(entry.storedAt) > maxStaleness || (!entry.tokenExp.IsZero() && !now.Before(entry.tokenExp)) {
+		return false, false
+	}
+
+	return entry.authorized, true
+}
+
+// set stores a decision. The TTL depends on the outcome and is capped at tokenExp when known;
+// decisions for already expired tokens are not stored.
+func (c *DecisionCache) set(key decisionKey, authorized bool, tokenExp time.Time) {
+	ttl := c.cfg.NegativeTTL
+	if authorized {
+		ttl = c.cfg.PositiveTTL
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	if !tokenExp.IsZero() && tokenExp.Before(expiresAt) {
+		expiresAt = tokenExp
+	}
+
+	if !now.Before(expiresAt) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, found := c.entries[key]; found {
+		entry := elem.Value.(*decisionEntry)
+		entry.authorized = authorized
+		entry.storedAt = now
+		entry.expiresAt = expiresAt
+		entry.tokenExp = tokenExp
+
+		c.lru.MoveToFront(elem)
+
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&decisionEntry{
+		key:        key,
+		authorized: authorized,
+		storedAt:   now,
+		expiresAt:  expiresAt,
+		tokenExp:   tokenExp,
+	})
+
+	for c.lru.Len() > c.cfg.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*decisionEntry).key)
+	}
+}
+
+// Len returns the number of entries currently held, including expired ones kept as last-known decisions.
+func (c *DecisionCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// purgeToken removes every decision made for accessToken, e.g. after it was revoked.
+func (c *DecisionCache) purgeToken(accessToken string) {
+	tokenHash := hashToken(accessToken)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, elem := range c.entries {
+		if key.tokenHash == tokenHash {
+			c.lru.Remove(elem)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Purge removes all cached decisions, e.g. after a permission change.
+func (c *DecisionCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[decisionKey]*list.Element)
+	c.lru.Init()
+}
@@ -0,0 +1,265 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	observability "github.com/LerianStudio/lib-observability"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// ---------------------------------------------------------------------------
+// DecisionCache
+// ---------------------------------------------------------------------------
+
+func TestDecisionCache_GetSet(t *testing.T) {
+	t.Parallel()
+
+	cache := NewDecisionCache(DecisionCacheConfig{})
+	key := newDecisionKey("acme/user1", "midaz", "ledgers", "get", "token")
+
+	_, ok := cache.get(key)
+	assert.False(t, ok)
+
+	cache.set(key, true, time.Time{})
+
+	authorized, ok := cache.get(key)
+	assert.True(t, ok)
+	assert.True(t, authorized)
+
+	cache.set(key, false, time.Time{})
+
+	authorized, ok = cache.get(key)
+	assert.True(t, ok)
+	assert.False(t, authorized)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestDecisionCache_KeyIncludesToken(t *testing.T) {
+	t.Parallel()
+
+	cache := NewDecisionCache(DecisionCacheConfig{})
+	cache.set(newDecisionKey("acme/user1", "midaz", "ledgers", "get", "token-a"), true, time.Time{})
+
+	_, ok := cache.get(newDecisionKey("acme/user1", "midaz", "ledgers", "get", "token-b"))
+	assert.False(t, ok)
+
+	_, ok = cache.get(newDecisionKey("acme/user1", "midaz", "ledgers", "post", "token-a"))
+	assert.False(t, ok)
+}
+
+func TestDecisionCache_TTL(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		authorized bool
+		tokenExp   time.Time
+		wantCached bool
+	}{
+		{name: "positive_within_ttl", authorized: true, wantCached: true},
+		{name: "negative_expired_by_short_ttl", authorized: false, wantCached: false},
+		{name: "bounded_by_token_exp", authorized: true, tokenExp: time.Now().Add(20 * time.Millisecond), wantCached: false},
+		{name: "expired_token_not_stored", authorized: true, tokenExp: time.Now().Add(-time.Second), wantCached: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cache := NewDecisionCache(DecisionCacheConfig{PositiveTTL: time.Hour, NegativeTTL: 20 * time.Millisecond})
+			key := newDecisionKey("s", "p", "r", "a", "t")
+
+			cache.set(key, tt.authorized, tt.tokenExp)
+			time.Sleep(50 * time.Millisecond)
+
+			_, ok := cache.get(key)
+			assert.Equal(t, tt.wantCached, ok)
+		})
+	}
+}
+
+func TestDecisionCache_GetStale(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		tokenExp     time.Time
+		maxStaleness time.Duration
+		wantStale    bool
+	}{
+		{name: "expired_entry_within_max_staleness", maxStaleness: time.Hour, wantStale: true},
+		{name: "older_than_max_staleness", maxStaleness: 10 * time.Millisecond, wantStale: false},
+		{name: "token_expired", tokenExp: time.Now().Add(40 * time.Millisecond), maxStaleness: time.Hour, wantStale: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cache := NewDecisionCache(DecisionCacheConfig{PositiveTTL: 20 * time.Millisecond})
+			key := newDecisionKey("s", "p", "r", "a", "t")
+
+			cache.set(key, true, tt.tokenExp)
+			time.Sleep(50 * time.Millisecond)
+
+			_, ok := cache.get(key)
+			require.False(t, ok)
+
+			authorized, ok := cache.getStale(key, tt.maxStaleness)
+			assert.Equal(t, tt.wantStale, ok)
+			assert.Equal(t, tt.wantStale, authorized)
+		})
+	}
+}
+
+func TestDecisionCache_LRUEviction(t *testing.T) {
+	t.Parallel()
+
+	cache := NewDecisionCache(DecisionCacheConfig{MaxEntries: 2})
+
+	first := newDecisionKey("s", "p", "r", "a", "1")
+	second := newDecisionKey("s", "p", "r", "a", "2")
+	third := newDecisionKey("s", "p", "r", "a", "3")
+
+	cache.set(first, true, time.Time{})
+	cache.set(second, true, time.Time{})
+
+	// Touch first so second becomes the least recently used.
+	_, ok := cache.get(first)
+	require.True(t, ok)
+
+	cache.set(third, true, time.Time{})
+
+	assert.Equal(t, 2, cache.Len())
+
+	_, ok = cache.get(second)
+	assert.False(t, ok)
+
+	_, ok = cache.get(first)
+	assert.True(t, ok)
+
+	_, ok = cache.get(third)
+	assert.True(t, ok)
+}
+
+func TestDecisionCache_Purge(t *testing.T) {
+	t.Parallel()
+
+	cache := NewDecisionCache(DecisionCacheConfig{})
+	cache.set(newDecisionKey("s", "p", "r", "a", "t"), true, time.Time{})
+
+	cache.Purge()
+
+	assert.Equal(t, 0, cache.Len())
+}
+
+// ---------------------------------------------------------------------------
+// checkAuthorization with DecisionCache
+// ---------------------------------------------------------------------------
+
+func TestCheckAuthorization_WithDecisionCache(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(AuthResponse{Authorized: true})
+	}))
+	defer server.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { require.NoError(t, tp.Shutdown(context.Background())) })
+
+	auth := &AuthClient{
+		Address:       server.URL,
+		Enabled:       true,
+		Logger:        &testLogger{},
+		DecisionCache: NewDecisionCache(DecisionCacheConfig{}),
+	}
+
+	token := createTestJWT(jwt.MapClaims{
+		"type":  "normal-user",
+		"owner": "acme-org",
+		"sub":   "user123",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+
+	ctx := observability.ContextWithTracer(context.Background(), tp.Tracer("test"))
+
+	for range 3 {
+		authorized, statusCode, err := auth.checkAuthorization(ctx, "midaz", "ledgers", "get", token)
+		require.NoError(t, err)
+		assert.True(t, authorized)
+		assert.Equal(t, http.StatusOK, statusCode)
+	}
+
+	assert.Equal(t, int32(1), calls.Load(), "repeated checks must be served from the cache")
+
+	var hits, misses int
+
+	for _, span := range exporter.GetSpans() {
+		for _, attr := range span.Attributes {
+			if attr.Key == "app.auth.decision_cache.hit" {
+				if attr.Value.AsBool() {
+					hits++
+				} else {
+					misses++
+				}
+			}
+		}
+	}
+
+	assert.Equal(t, 2, hits)
+	assert.Equal(t, 1, misses)
+
+	// A different action is a different key.
+	_, _, err := auth.checkAuthorization(ctx, "midaz", "ledgers", "delete", token)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestCheckAuthorization_WithDecisionCache_ErrorsAreNotCached(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(map[string]string{"code": "FORBIDDEN", "message": "nope"})
+	}))
+	defer server.Close()
+
+	auth := &AuthClient{
+		Address:       server.URL,
+		Enabled:       true,
+		Logger:        &testLogger{},
+		DecisionCache: NewDecisionCache(DecisionCacheConfig{}),
+	}
+
+	token := createTestJWT(jwt.MapClaims{"type": "normal-user", "owner": "acme-org", "sub": "user123"})
+
+	for range 2 {
+		_, _, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+		require.Error(t, err)
+	}
+
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, 0, auth.DecisionCache.Len())
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultMaxStaleness = 5 * time.Minute
+
+// FailureMode decides the outcome of an authorization check when the auth service is
+// unavailable: unreachable, answering 5xx, or short-circuited by the circuit breaker.
+type FailureMode int
+
+const (
+	// FailClosed rejects the request. This is the default.
+	FailClosed FailureMode = iota
+	// FailOpen allows the request and logs it loudly for audit. It requires a Verifier
+	// (WithJWKS), so that only valid tokens are let through: without one it fails closed.
+	FailOpen
+	// FailStale serves the last-known decision from the DecisionCache when it is not older
+	// than MaxStaleness, and fails closed otherwise. Requires WithDecisionCache.
+	FailStale
+)
+
+// String returns the name used in logs and span attributes.
+func (m FailureMode) String() string {
+	switch m {
+	case FailOpen:
+		return "fail_open"
+	case FailStale:
+		return "fail_stale"
+	default:
+		return "fail_closed"
+	}
+}
+
+// DegradationPolicy configures how authorization checks degrade during an auth service outage.
+// - Mode selects the behavior (default FailClosed).
+// - MaxStaleness bounds the age of decisions served in FailStale mode (default 5m).
+// Stale decisions never outlive the token's "exp" claim.
+type DegradationPolicy struct {
+	Mode         FailureMode
+	MaxStaleness time.Duration
+}
+
+func (p DegradationPolicy) maxStaleness() time.Duration {
+	if p.MaxStaleness <= 0 {
+		return defaultMaxStaleness
+	}
+
+	return p.MaxStaleness
+}
+
+// strictness ranks p.Mode from FailOpen (0) to FailClosed (2).
+func (p DegradationPolicy) strictness() int {
+	switch p.Mode {
+	case FailOpen:
+		return 0
+	case FailStale:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// stricter returns the stricter of p and other: FailClosed over FailStale over FailOpen, and the
+// shorter MaxStaleness between two FailStale policies.
+func (p DegradationPolicy) stricter(other DegradationPolicy) DegradationPolicy {
+	switch {
+	case other.strictness() > p.strictness():
+		return other
+	case other.strictness() == p.strictness() && other.Mode == FailStale && other.maxStaleness() < p.maxStaleness():
+		return other
+	default:
+		return p
+	}
+}
+
+// AuthorizeOption configures a single route protected by Authorize.
+type AuthorizeOption func(*authorizeConfig)
+
+type authorizeConfig struct {
+	degradation *DegradationPolicy
+	tenantGuard *TenantSource
+	condition   string
+}
+
+// WithRouteDegradation overrides the client's DegradationPolicy for one route.
+func WithRouteDegradation(policy DegradationPolicy) AuthorizeOption {
+	return func(c *authorizeConfig) {
+		c.degradation = &policy
+	}
+}
+
+// degrade applies the degradation policy, or the client's when policy is nil, to a check
+// the auth service could not answer. It reports the decision to use, if any.
+func (auth *AuthClient) degrade(ctx context.Context, span trace.Span, policy *DegradationPolicy, key decisionKey) (authorized, ok bool) {
+	p := auth.Degradation
+	if policy != nil {
+		p = *policy
+	}
+
+	switch p.Mode {
+	case FailOpen:
+		// Without a Verifier, nothing but the unavailable auth service vouches for the token.
+		if auth.Verifier == nil {
+			logErrorf(ctx, auth.Logger, "%s unavailable, failing closed: FailOpen requires WithJWKS", pluginName)
+
+			return false, false
+		}
+
+		logErrorf(ctx, auth.Logger, "AUDIT: %s unavailable, failing open: sub=%s product=%s resource=%s action=%s",
+			pluginName, key.subject, key.product, key.resource, key.action)
+
+		authorized, ok = true, true
+	case FailStale:
+		if auth.DecisionCache == nil {
+			return false, false
+		}
+
+		authorized, ok = auth.DecisionCache.getStale(key, p.maxStaleness())
+		if !ok {
+			return false, false
+		}
+
+		logWarnf(ctx, auth.Logger, "%s unavailable, serving stale decision: sub=%s product=%s resource=%s action=%s authorized=%t",
+			pluginName, key.subject, key.product, key.resource, key.action, authorized)
+	default:
+		return false, false
+	}
+
+	span.SetAttributes(attribute.String("app.auth.degradation.mode", p.Mode.String()))
+
+	return authorized, ok
+}
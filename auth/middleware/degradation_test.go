@@ -0,0 +1,252 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ---------------------------------------------------------------------------
+// DegradationPolicy
+// ---------------------------------------------------------------------------
+
+func TestDegradationPolicy_Stricter(t *testing.T) {
+	t.Parallel()
+
+	open := DegradationPolicy{Mode: FailOpen}
+	closed := DegradationPolicy{Mode: FailClosed}
+	stale := DegradationPolicy{Mode: FailStale}
+	shortStale := DegradationPolicy{Mode: FailStale, MaxStaleness: time.Minute}
+
+	tests := []struct {
+		name string
+		a, b DegradationPolicy
+		want DegradationPolicy
+	}{
+		{name: "closed_over_open", a: open, b: closed, want: closed},
+		{name: "closed_over_stale", a: closed, b: stale, want: closed},
+		{name: "stale_over_open", a: stale, b: open, want: stale},
+		{name: "shorter_staleness", a: stale, b: shortStale, want: shortStale},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, tt.a.stricter(tt.b))
+			assert.Equal(t, tt.want, tt.b.stricter(tt.a))
+		})
+	}
+}
+
+func TestDegradation_ClientPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		policy         DegradationPolicy
+		wantAuthorized bool
+		wantStatus     int
+		wantErr        bool
+	}{
+		{name: "fail_closed_by_default", policy: DegradationPolicy{}, wantStatus: http.StatusInternalServerError, wantErr: true},
+		{name: "fail_open", policy: DegradationPolicy{Mode: FailOpen}, wantAuthorized: true, wantStatus: http.StatusOK},
+		{name: "fail_stale_without_cache_fails_closed", policy: DegradationPolicy{Mode: FailStale}, wantStatus: http.StatusInternalServerError, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newAuthServer(t)
+			server.down.Store(true)
+
+			verifier, sign := newTestVerifier(t)
+
+			auth := NewAuthClientWithOptions(server.URL,
+				WithHealthCheck(false),
+				WithLogger(&testLogger{}),
+				WithDegradation(tt.policy),
+			)
+			auth.Verifier = verifier
+
+			authorized, statusCode, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", sign(userClaims()))
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantAuthorized, authorized)
+			assert.Equal(t, tt.wantStatus, statusCode)
+		})
+	}
+}
+
+func TestDegradation_FailOpenRequiresVerifier(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+	server.down.Store(true)
+
+	logger := &recordingLogger{}
+
+	auth := NewAuthClientWithOptions(server.URL,
+		WithHealthCheck(false),
+		WithLogger(logger),
+		WithDegradation(DegradationPolicy{Mode: FailOpen}),
+		WithMultiTenant(MultiTenantConfig{Enabled: true}),
+	)
+	assert.True(t, logger.contains("FailOpen requires WithJWKS"))
+
+	// Signed with an arbitrary key: only the auth service could have rejected it.
+	forged := createTestJWT(userClaims(jwt.MapClaims{"tenantId": "victim"}))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+forged))
+
+	called := false
+
+	_, err := NewGRPCAuthUnaryPolicy(auth, PolicyConfig{DefaultPolicy: &Policy{Resource: "ledgers", Action: "get"}})(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Get"},
+		func(context.Context, any) (any, error) {
+			called = true
+
+			return "ok", nil
+		})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.False(t, called)
+}
+
+func TestDegradation_FailStale(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+
+	auth := NewAuthClientWithOptions(server.URL,
+		WithHealthCheck(false),
+		WithLogger(&testLogger{}),
+		WithDecisionCache(DecisionCacheConfig{PositiveTTL: 10 * time.Millisecond}),
+		WithDegradation(DegradationPolicy{Mode: FailStale, MaxStaleness: 200 * time.Millisecond}),
+	)
+	token := createTestJWT(userClaims())
+
+	authorized, _, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+	require.NoError(t, err)
+	require.True(t, authorized)
+
+	time.Sleep(20 * time.Millisecond)
+	server.down.Store(true)
+
+	authorized, statusCode, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+	require.NoError(t, err, "a decision within MaxStaleness must be served")
+	assert.True(t, authorized)
+	assert.Equal(t, http.StatusOK, statusCode)
+
+	_, _, err = auth.checkAuthorization(context.Background(), "midaz", "ledgers", "post", token)
+	require.Error(t, err, "there is no last-known decision for another action")
+
+	time.Sleep(200 * time.Millisecond)
+
+	_, statusCode, err = auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+	require.Error(t, err, "a decision older than MaxStaleness must not be served")
+	assert.Equal(t, http.StatusInternalServerError, statusCode)
+}
+
+func TestDegradation_DecisionsAreNotDegraded(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"code":"AUT-0403","title":"Forbidden","message":"no access"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	auth := NewAuthClientWithOptions(server.URL,
+		WithHealthCheck(false),
+		WithLogger(&testLogger{}),
+		WithDegradation(DegradationPolicy{Mode: FailOpen}),
+	)
+
+	authorized, statusCode, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", createTestJWT(userClaims()))
+	require.Error(t, err)
+	assert.False(t, authorized)
+	assert.Equal(t, http.StatusForbidden, statusCode)
+}
+
+func TestAuthorize_RouteDegradation(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+	server.down.Store(true)
+
+	verifier, sign := newTestVerifier(t)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+	auth.Verifier = verifier
+
+	app := fiber.New()
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) }
+
+	app.Get("/closed", auth.Authorize("midaz", "ledgers", "get"), ok)
+	app.Get("/open", auth.Authorize("midaz", "ledgers", "get", WithRouteDegradation(DegradationPolicy{Mode: FailOpen})), ok)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{path: "/closed", wantStatus: http.StatusInternalServerError},
+		{path: "/open", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+sign(userClaims()))
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		assert.Equal(t, tt.wantStatus, resp.StatusCode, tt.path)
+	}
+}
+
+func TestNewGRPCAuthUnaryPolicy_PolicyDegradation(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+	server.down.Store(true)
+
+	verifier, sign := newTestVerifier(t)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+	auth.Verifier = verifier
+
+	interceptor := NewGRPCAuthUnaryPolicy(auth, PolicyConfig{
+		MethodPolicies: map[string]Policy{
+			"/pkg.Service/Read":  {Resource: "ledgers", Action: "get", Degradation: &DegradationPolicy{Mode: FailOpen}},
+			"/pkg.Service/Write": {Resource: "ledgers", Action: "post"},
+		},
+	})
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+sign(userClaims())))
+	handler := func(_ context.Context, _ any) (any, error) { return "ok", nil }
+
+	resp, err := interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Read"}, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+
+	_, err = interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Write"}, handler)
+	require.Error(t, err)
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
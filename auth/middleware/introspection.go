@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/LerianStudio/lib-observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultIntrospectionCacheTTL        = 10 * time.Second
+	defaultIntrospectionCacheMaxEntries = 10000
+	introspectionAction                 = "introspect"
+)
+
+// ErrTokenInactive is returned when introspection reports the access token as not active,
+// e.g. because it was revoked.
+var ErrTokenInactive = errors.New("token is not active")
+
+// IntrospectionConfig makes every authorization check require an active token (RFC 7662)
+// before calling /v1/authorize, so revoked tokens stop working without waiting for "exp".
+// - ClientID and ClientSecret authenticate the introspection requests.
+// - CacheTTL is how long an introspection result is reused (default 10s); results never outlive the token's "exp".
+// - MaxEntries bounds the result cache (default 10000).
+type IntrospectionConfig struct {
+	ClientID     string
+	ClientSecret string
+	CacheTTL     time.Duration
+	MaxEntries   int
+}
+
+// IntrospectionResult is the introspection response of the auth service (RFC 7662).
+// Only Active is guaranteed; the other fields are set for active tokens when known.
+type IntrospectionResult struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Nbf       int64  `json:"nbf,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Aud       any    `json:"aud,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+}
+
+// introspector holds the introspection settings and result cache of an AuthClient.
+type introspector struct {
+	cfg   IntrospectionConfig
+	cache *DecisionCache
+}
+
+func newIntrospector(cfg IntrospectionConfig) *introspector {
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = defaultIntrospectionCacheTTL
+	}
+
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = defaultIntrospectionCacheMaxEntries
+	}
+
+	return &introspector{
+		cfg: cfg,
+		cache: NewDecisionCache(DecisionCacheConfig{
+			PositiveTTL: cfg.CacheTTL,
+			NegativeTTL: cfg.CacheTTL,
+			MaxEntries:  cfg.MaxEntries,
+		}),
+	}
+}
+
+// IntrospectToken asks the auth service whether token is active (RFC 7662). tokenTypeHint is
+// "access_token", "refresh_token" or empty. The request is authenticated with the credentials of
+// WithIntrospection, when configured. Rejections are returned as *TokenError. Disabled clients
+// report every token as active.
+func (auth *AuthClient) IntrospectToken(ctx context.Context, token, tokenTypeHint string) (*IntrospectionResult, error) {
+	tracer, reqID := auth.tracking(ctx)
+
+	ctx, span := tracer.Start(ctx, "lib_auth.introspect_token")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("app.request.request_id", reqID),
+	)
+
+	if !auth.Enabled || auth.Address == "" {
+		return &IntrospectionResult{Active: true}, nil
+	}
+
+	var clientID, clientSecret string
+	if auth.introspection != nil {
+		clientID, clientSecret = auth.introspection.cfg.ClientID, auth.introspection.cfg.ClientSecret
+	}
+
+	requestBody := map[string]string{
+		"clientId":     clientID,
+		"clientSecret": clientSecret,
+		"token":        token,
+	}
+
+	// tracePayload omits clientSecret and token so credentials never flow into telemetry.
+	tracePayload := map[string]string{
+		"clientId": clientID,
+	}
+
+	if tokenTypeHint != "" {
+		requestBody["tokenTypeHint"] = tokenTypeHint
+		tracePayload["tokenTypeHint"] = tokenTypeHint
+	}
+
+	body, _, err := auth.postOAuth(ctx, span, "/v1/login/oauth/introspect", requestBody, tracePayload)
+	if err != nil {
+		return nil, err
+	}
+
+	var result IntrospectionResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		logErrorf(ctx, auth.Logger, "Failed to unmarshal introspection response: %v", err)
+
+		tracing.HandleSpanError(span, "Failed to unmarshal introspection response", err)
+
+		return nil, fmt.Errorf("failed to unmarshal introspection response: %w", err)
+	}
+
+	span.SetAttributes(attribute.Bool("app.auth.introspection.active", result.Active))
+
+	return &result, nil
+}
+
+// requireActive rejects accessToken with 401 unless introspection reports it as active.
+// Introspection failures fail closed with 500, or 503 while the circuit breaker is open.
+func (auth *AuthClient) requireActive(ctx context.Context, span trace.Span, accessToken string) (int, error) {
+	key := newDecisionKey("", "", "", introspectionAction, accessToken)
+
+	active, hit := auth.introspection.cache.get(key)
+
+	span.SetAttributes(attribute.Bool("app.auth.introspection.cache_hit", hit))
+
+	if !hit {
+		result, err := auth.IntrospectToken(ctx, accessToken, "access_token")
+		if err != nil {
+			logErrorf(ctx, auth.Logger, "Failed to introspect token: %v", err)
+
+			tracing.HandleSpanError(span, "Failed to introspect token", err)
+
+			if errors.Is(err, ErrCircuitOpen) {
+				return http.StatusServiceUnavailable, err
+			}
+
+			return http.StatusInternalServerError, err
+		}
+
+		active = result.Active
+
+		var exp time.Time
+		if result.Exp > 0 {
+			exp = time.Unix(result.Exp, 0)
+		}
+
+		auth.introspection.cache.set(key, active, exp)
+	}
+
+	if !active {
+		logErrorf(ctx, auth.Logger, "Token is not active")
+
+		tracing.HandleSpanError(span, "Token is not active", ErrTokenInactive)
+
+		return http.StatusUnauthorized, ErrTokenInactive
+	}
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// introspectionServer reports tokens as active unless revoked, authorizes every request and
+// accepts revocations, counting introspection and authorization requests.
+type introspectionServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	revoked map[string]bool
+
+	introspections atomic.Int32
+	authorizations atomic.Int32
+}
+
+func newIntrospectionServer(t *testing.T) *introspectionServer {
+	t.Helper()
+
+	is := &introspectionServer{revoked: map[string]bool{}}
+
+	is.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/v1/login/oauth/introspect":
+			is.introspections.Add(1)
+
+			assert.Equal(t, "introspector", body["clientId"])
+			assert.Equal(t, "introspector-secret", body["clientSecret"])
+
+			is.mu.Lock()
+			active := !is.revoked[body["token"]]
+			is.mu.Unlock()
+
+			result := IntrospectionResult{Active: active}
+			if active {
+				result.Sub = "user1"
+				result.Scope = "ledgers:read"
+				result.Exp = time.Now().Add(time.Hour).Unix()
+			}
+
+			_ = json.NewEncoder(w).Encode(result)
+		case "/v1/login/oauth/revoke":
+			is.revoke(body["token"])
+		default:
+			is.authorizations.Add(1)
+
+			_ = json.NewEncoder(w).Encode(AuthResponse{Authorized: true})
+		}
+	}))
+	t.Cleanup(is.Close)
+
+	return is
+}
+
+func (is *introspectionServer) revoke(token string) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	is.revoked[token] = true
+}
+
+func introspectingClient(address string) *AuthClient {
+	return NewAuthClientWithOptions(address,
+		WithHealthCheck(false),
+		WithLogger(&testLogger{}),
+		WithIntrospection(IntrospectionConfig{ClientID: "introspector", ClientSecret: "introspector-secret", CacheTTL: time.Minute}),
+	)
+}
+
+// ---------------------------------------------------------------------------
+// IntrospectToken
+// ---------------------------------------------------------------------------
+
+func TestIntrospectToken(t *testing.T) {
+	t.Parallel()
+
+	server := newIntrospectionServer(t)
+	server.revoke("revoked-token")
+
+	auth := introspectingClient(server.URL)
+
+	result, err := auth.IntrospectToken(context.Background(), "live-token", "access_token")
+	require.NoError(t, err)
+	assert.True(t, result.Active)
+	assert.Equal(t, "user1", result.Sub)
+	assert.Equal(t, "ledgers:read", result.Scope)
+
+	result, err = auth.IntrospectToken(context.Background(), "revoked-token", "")
+	require.NoError(t, err)
+	assert.False(t, result.Active)
+	assert.Empty(t, result.Sub)
+}
+
+// ---------------------------------------------------------------------------
+// Authorization with introspection
+// ---------------------------------------------------------------------------
+
+func TestCheckAuthorization_WithIntrospection(t *testing.T) {
+	t.Parallel()
+
+	server := newIntrospectionServer(t)
+	auth := introspectingClient(server.URL)
+
+	token := createTestJWT(jwt.MapClaims{"type": "normal-user", "owner": "org1", "sub": "user1"})
+
+	for range 2 {
+		authorized, statusCode, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+		require.NoError(t, err)
+		assert.True(t, authorized)
+		assert.Equal(t, http.StatusOK, statusCode)
+	}
+
+	assert.Equal(t, int32(1), server.introspections.Load(), "the introspection result must be cached")
+	assert.Equal(t, int32(2), server.authorizations.Load())
+
+	require.NoError(t, auth.RevokeToken(context.Background(), "client", "secret", token, "access_token"))
+
+	authorized, statusCode, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+	require.ErrorIs(t, err, ErrTokenInactive)
+	assert.False(t, authorized)
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+	assert.Equal(t, int32(2), server.introspections.Load(), "revoking through the client must drop the cached result")
+	assert.Equal(t, int32(2), server.authorizations.Load(), "inactive tokens must not reach /v1/authorize")
+}
+
+func TestCheckAuthorization_IntrospectionUnavailable(t *testing.T) {
+	t.Parallel()
+
+	server := newIntrospectionServer(t)
+	auth := introspectingClient(server.URL)
+	server.Close()
+
+	token := createTestJWT(jwt.MapClaims{"type": "normal-user", "owner": "org1", "sub": "user1"})
+
+	authorized, statusCode, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+	require.Error(t, err)
+	assert.False(t, authorized)
+	assert.Equal(t, http.StatusInternalServerError, statusCode)
+}
+
+func TestNewGRPCAuthUnaryPolicy_InactiveToken(t *testing.T) {
+	t.Parallel()
+
+	server := newIntrospectionServer(t)
+	auth := introspectingClient(server.URL)
+
+	token := createTestJWT(jwt.MapClaims{"type": "normal-user", "owner": "org1", "sub": "user1"})
+	server.revoke(token)
+
+	interceptor := NewGRPCAuthUnaryPolicy(auth, PolicyConfig{DefaultPolicy: &Policy{Resource: "ledgers", Action: "get"}})
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+
+	_, err := interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/DoThing"}, func(context.Context, any) (any, error) {
+		t.Fatal("handler must not be called for an inactive token")
+
+		return nil, nil
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, int32(0), server.authorizations.Load())
+}
@@ -0,0 +1,427 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultJWKSRefreshInterval    = 15 * time.Minute
+	defaultJWKSMinRefreshInterval = 10 * time.Second
+)
+
+// supportedSigningMethods lists the JWS algorithms accepted by JWKSVerifier.
+// Symmetric algorithms are intentionally absent: a JWKS only publishes public keys.
+var supportedSigningMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+var (
+	// ErrJWKSUnavailable is returned when the signing keys cannot be fetched and none are cached.
+	// It represents a server-side failure, not an invalid token.
+	ErrJWKSUnavailable = errors.New("jwks unavailable")
+
+	// ErrUnknownSigningKey is returned when the token's kid is not present in the JWKS, even after a refresh.
+	ErrUnknownSigningKey = errors.New("unknown signing key")
+)
+
+// JWKSConfig configures local JWT verification against the auth service JWKS.
+// - URL is the JWKS endpoint (e.g. "http://plugin-auth:4000/.well-known/jwks.json"). Required
+//   unless JSON is set.
+// - JSON is a static JWKS document, e.g. read from a file, used instead of fetching URL. Its keys
+//   never change, so the refresh settings and HTTPClient do not apply.
+// - Issuer and Audience, when set, must match the "iss" and "aud" claims.
+// - RefreshInterval is how long fetched keys are cached before being refetched on next use.
+// - MinRefreshInterval throttles refetches triggered by an unknown kid (key rotation).
+// - Leeway tolerates clock skew on "exp", "nbf" and "iat".
+// - HTTPClient overrides the client used to fetch the JWKS; defaults to a dedicated client.
+type JWKSConfig struct {
+	URL                string
+	JSON               []byte
+	Issuer             string
+	Audience           []string
+	RefreshInterval    time.Duration
+	MinRefreshInterval time.Duration
+	Leeway             time.Duration
+	HTTPClient         *http.Client
+}
+
+// JWKSVerifier verifies JWT signatures and registered claims using keys published in a JWKS.
+// Keys are cached and refreshed on expiry or when a token references an unknown kid,
+// so key rotation on the auth service is picked up without restarts. Safe for concurrent use.
+type JWKSVerifier struct {
+	cfg    JWKSConfig
+	parser *jwt.Parser
+
+	// refreshes coalesces concurrent refetches into one request, made without holding mu.
+	refreshes singleflight.Group
+
+	mu          sync.RWMutex
+	keys        map[string]jwk
+	fetchedAt   time.Time
+	lastAttempt time.Time
+
+	// staticErr is why JSON could not be parsed, if set.
+	staticErr error
+}
+
+// jwk is a parsed JSON Web Key with its declared algorithm (may be empty).
+type jwk struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// rawJWK mirrors the JSON representation of a public JWK (RFC 7517/7518/8037).
+type rawJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// NewJWKSVerifier creates a JWKSVerifier. Keys are fetched lazily on the first Verify call, unless
+// cfg.JSON provides them. An invalid cfg.JSON makes every Verify fail with ErrJWKSUnavailable.
+func NewJWKSVerifier(cfg JWKSConfig) *JWKSVerifier {
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = defaultJWKSRefreshInterval
+	}
+
+	if cfg.MinRefreshInterval <= 0 {
+		cfg.MinRefreshInterval = defaultJWKSMinRefreshInterval
+	}
+
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = newHTTPClient(defaultHTTPTimeout, nil)
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(supportedSigningMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+
+	if len(cfg.Audience) > 0 {
+		opts = append(opts, jwt.WithAudience(cfg.Audience...))
+	}
+
+	v := &JWKSVerifier{
+		cfg:    cfg,
+		parser: jwt.NewParser(opts...),
+	}
+
+	if cfg.JSON != nil {
+		v.keys, v.staticErr = parseJWKS(cfg.JSON)
+	}
+
+	return v
+}
+
+// Verify checks the token signature against the JWKS and validates "exp", "nbf", "iss" and "aud".
+// It returns the token claims on success. Errors wrapping ErrJWKSUnavailable indicate the keys
+// could not be obtained; any other error means the token itself is invalid.
+func (v *JWKSVerifier) Verify(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := v.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key, err := v.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+
+		if key.alg != "" && key.alg != token.Method.Alg() {
+			return nil, fmt.Errorf("token alg %q does not match key alg %q", token.Method.Alg(), key.alg)
+		}
+
+		return key.key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// key returns the key for kid, refreshing the JWKS when the cache is stale or the kid is unknown.
+// A stale key is returned at once while the refresh runs in the background, and kept during an
+// outage. An empty kid is accepted only when the JWKS holds exactly one key. Static keys are
+// never refreshed.
+func (v *JWKSVerifier) key(ctx context.Context, kid string) (jwk, error) {
+	if v.cfg.JSON != nil {
+		if v.staticErr != nil {
+			return jwk{}, fmt.Errorf("%w: %w", ErrJWKSUnavailable, v.staticErr)
+		}
+
+		k, found := lookupKey(v.keys, kid)
+		if !found {
+			return jwk{}, fmt.Errorf("%w: kid %q", ErrUnknownSigningKey, kid)
+		}
+
+		return k, nil
+	}
+
+	v.mu.RLock()
+	k, found := lookupKey(v.keys, kid)
+	fresh := !v.fetchedAt.IsZero() && time.Since(v.fetchedAt) < v.cfg.RefreshInterval
+	v.mu.RUnlock()
+
+	if found && fresh {
+		return k, nil
+	}
+
+	ch := v.refreshes.DoChan("jwks", func() (any, error) {
+		fetchCtx, cancel := detachedContext(ctx)
+		defer cancel()
+
+		return nil, v.refresh(fetchCtx, !found)
+	})
+
+	if found {
+		// Serve the stale key rather than waiting for the refresh or rejecting valid tokens.
+		return k, nil
+	}
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return jwk{}, res.Err
+		}
+	case <-ctx.Done():
+		return jwk{}, fmt.Errorf("%w: %w", ErrJWKSUnavailable, ctx.Err())
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if k, found = lookupKey(v.keys, kid); !found {
+		return jwk{}, fmt.Errorf("%w: kid %q", ErrUnknownSigningKey, kid)
+	}
+
+	return k, nil
+}
+
+// lookupKey finds kid in keys; an empty kid matches a single-key set.
+func lookupKey(keys map[string]jwk, kid string) (jwk, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, k := range keys {
+			return k, true
+		}
+	}
+
+	k, ok := keys[kid]
+
+	return k, ok
+}
+
+// refresh refetches the JWKS. Attempts are throttled by MinRefreshInterval so tokens with random
+// kids, or an unreachable auth service, cannot force a fetch per request. The fetch runs without
+// holding mu, so verifications with cached keys never wait for it.
+func (v *JWKSVerifier) refresh(ctx context.Context, unknownKid bool) error {
+	v.mu.Lock()
+
+	if !unknownKid && !v.fetchedAt.IsZero() && time.Since(v.fetchedAt) < v.cfg.RefreshInterval {
+		// Another refresh completed since the caller found the keys stale.
+		v.mu.Unlock()
+
+		return nil
+	}
+
+	if !v.lastAttempt.IsZero() && time.Since(v.lastAttempt) < v.cfg.MinRefreshInterval {
+		cached := v.keys != nil
+		v.mu.Unlock()
+
+		if !cached {
+			return fmt.Errorf("%w: refresh throttled", ErrJWKSUnavailable)
+		}
+
+		return nil
+	}
+
+	v.lastAttempt = time.Now()
+	v.mu.Unlock()
+
+	keys, err := v.fetch(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrJWKSUnavailable, err)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.keys = keys
+	v.fetchedAt = time.Now()
+
+	return nil
+}
+
+// fetch downloads and parses the JWKS.
+func (v *JWKSVerifier) fetch(ctx context.Context) (map[string]jwk, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.cfg.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := v.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	return parseJWKS(body)
+}
+
+// parseJWKS parses a JWKS document. Keys with an unsupported type or "use" other than "sig" are skipped.
+func parseJWKS(body []byte) (map[string]jwk, error) {
+	var set struct {
+		Keys []rawJWK `json:"keys"`
+	}
+
+	if err := json.Unmarshal(body, &set); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal jwks: %w", err)
+	}
+
+	keys := make(map[string]jwk, len(set.Keys))
+
+	for _, raw := range set.Keys {
+		if raw.Use != "" && raw.Use != "sig" {
+			continue
+		}
+
+		pub, err := raw.publicKey()
+		if err != nil {
+			continue
+		}
+
+		keys[raw.Kid] = jwk{alg: raw.Alg, key: pub}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("jwks contains no usable signing keys")
+	}
+
+	return keys, nil
+}
+
+// publicKey decodes the RSA, EC or OKP (Ed25519) public key material of the JWK.
+func (r rawJWK) publicKey() (crypto.PublicKey, error) {
+	switch r.Kty {
+	case "RSA":
+		n, err := decodeBase64URLInt(r.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBase64URLInt(r.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() > int64(^uint32(0)>>1) {
+			return nil, errors.New("rsa exponent out of range")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+
+		switch r.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", r.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(r.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(r.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid ec coordinate size")
+		}
+
+		point := append(append([]byte{0x04}, x...), y...)
+
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	case "OKP":
+		if r.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", r.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(r.X)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key size")
+		}
+
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", r.Kty)
+	}
+}
+
+func decodeBase64URLInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) == 0 {
+		return nil, errors.New("empty key parameter")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
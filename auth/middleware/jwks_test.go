@@ -0,0 +1,558 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ---------------------------------------------------------------------------
+// Test helpers
+// ---------------------------------------------------------------------------
+
+// testSigningKey is a private key with the kid and JWS algorithm it signs with.
+type testSigningKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    crypto.Signer
+}
+
+func newRSASigningKey(t *testing.T, kid string) testSigningKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	return testSigningKey{kid: kid, method: jwt.SigningMethodRS256, key: key}
+}
+
+func newECSigningKey(t *testing.T, kid string) testSigningKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	return testSigningKey{kid: kid, method: jwt.SigningMethodES256, key: key}
+}
+
+func newEdDSASigningKey(t *testing.T, kid string) testSigningKey {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return testSigningKey{kid: kid, method: jwt.SigningMethodEdDSA, key: key}
+}
+
+// sign builds a JWT signed with k and carrying its kid header.
+func (k testSigningKey) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.kid
+
+	signed, err := token.SignedString(k.key)
+	require.NoError(t, err)
+
+	return signed
+}
+
+// jwk returns the public JWK representation of k.
+func (k testSigningKey) jwk(t *testing.T) rawJWK {
+	t.Helper()
+
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	switch pub := k.key.Public().(type) {
+	case *rsa.PublicKey:
+		return rawJWK{Kty: "RSA", Kid: k.kid, Use: "sig", Alg: k.method.Alg(), N: b64(pub.N.Bytes()), E: b64(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		raw, err := pub.Bytes()
+		require.NoError(t, err)
+
+		size := (len(raw) - 1) / 2
+
+		return rawJWK{Kty: "EC", Kid: k.kid, Crv: "P-256", X: b64(raw[1 : 1+size]), Y: b64(raw[1+size:])}
+	case ed25519.PublicKey:
+		return rawJWK{Kty: "OKP", Kid: k.kid, Crv: "Ed25519", X: b64(pub)}
+	default:
+		t.Fatalf("unsupported key type %T", pub)
+
+		return rawJWK{}
+	}
+}
+
+// jwksServer serves a mutable JWKS and counts fetches. While hold is set, fetches wait for it to
+// be closed.
+type jwksServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	keys    []rawJWK
+	hold    chan struct{}
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, keys ...testSigningKey) *jwksServer {
+	t.Helper()
+
+	s := &jwksServer{}
+	s.setKeys(t, keys...)
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		s.fetches.Add(1)
+
+		s.mu.Lock()
+		hold := s.hold
+		s.mu.Unlock()
+
+		if hold != nil {
+			<-hold
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(map[string]any{"keys": s.keys}); err != nil {
+			t.Errorf("jwks server: failed to encode response: %v", err)
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *jwksServer) setKeys(t *testing.T, keys ...testSigningKey) {
+	t.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = s.keys[:0]
+	for _, k := range keys {
+		s.keys = append(s.keys, k.jwk(t))
+	}
+}
+
+// holdFetches makes fetches wait until the returned function is called.
+func (s *jwksServer) holdFetches(t *testing.T) func() {
+	t.Helper()
+
+	hold := make(chan struct{})
+
+	s.mu.Lock()
+	s.hold = hold
+	s.mu.Unlock()
+
+	var once sync.Once
+
+	release := func() {
+		once.Do(func() {
+			s.mu.Lock()
+			s.hold = nil
+			s.mu.Unlock()
+
+			close(hold)
+		})
+	}
+	t.Cleanup(release)
+
+	return release
+}
+
+// staticJWKS returns the JWKS document publishing keys.
+func staticJWKS(t *testing.T, keys ...testSigningKey) []byte {
+	t.Helper()
+
+	set := map[string][]rawJWK{"keys": {}}
+	for _, k := range keys {
+		set["keys"] = append(set["keys"], k.jwk(t))
+	}
+
+	doc, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	return doc
+}
+
+// newTestVerifier returns a JWKSVerifier trusting a fresh key and a function signing claims with
+// it, adding an expiry when the claims have none. The key is static: nothing is fetched.
+func newTestVerifier(t *testing.T) (*JWKSVerifier, func(jwt.MapClaims) string) {
+	t.Helper()
+
+	key := newRSASigningKey(t, "test-key")
+
+	sign := func(claims jwt.MapClaims) string {
+		signed := maps.Clone(claims)
+		if _, ok := signed["exp"]; !ok {
+			signed["exp"] = time.Now().Add(time.Hour).Unix()
+		}
+
+		return key.sign(t, signed)
+	}
+
+	return NewJWKSVerifier(JWKSConfig{JSON: staticJWKS(t, key)}), sign
+}
+
+// validClaims returns normal-user claims valid for the next hour.
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"type":  "normal-user",
+		"owner": "acme-org",
+		"sub":   "user123",
+		"iss":   "plugin-auth",
+		"aud":   "midaz",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+// ---------------------------------------------------------------------------
+// JWKSVerifier.Verify
+// ---------------------------------------------------------------------------
+
+func TestJWKSVerifier_Verify_SupportedAlgorithms(t *testing.T) {
+	t.Parallel()
+
+	keys := []testSigningKey{
+		newRSASigningKey(t, "rsa-1"),
+		newECSigningKey(t, "ec-1"),
+		newEdDSASigningKey(t, "ed-1"),
+	}
+
+	server := newJWKSServer(t, keys...)
+	verifier := NewJWKSVerifier(JWKSConfig{URL: server.URL, Issuer: "plugin-auth", Audience: []string{"midaz"}})
+
+	for _, k := range keys {
+		t.Run(k.method.Alg(), func(t *testing.T) {
+			t.Parallel()
+
+			claims, err := verifier.Verify(context.Background(), k.sign(t, validClaims()))
+			require.NoError(t, err)
+			assert.Equal(t, "user123", claims["sub"])
+		})
+	}
+}
+
+func TestJWKSVerifier_Verify_Rejections(t *testing.T) {
+	t.Parallel()
+
+	key := newRSASigningKey(t, "rsa-1")
+	server := newJWKSServer(t, key)
+	verifier := NewJWKSVerifier(JWKSConfig{URL: server.URL, Issuer: "plugin-auth", Audience: []string{"midaz"}})
+
+	forger := newRSASigningKey(t, "rsa-1")
+
+	with := func(mutate func(jwt.MapClaims)) jwt.MapClaims {
+		c := validClaims()
+		mutate(c)
+
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{
+			name:  "forged_signature_with_known_kid",
+			token: forger.sign(t, validClaims()),
+		},
+		{
+			name:  "expired",
+			token: key.sign(t, with(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() })),
+		},
+		{
+			name:  "missing_exp",
+			token: key.sign(t, with(func(c jwt.MapClaims) { delete(c, "exp") })),
+		},
+		{
+			name:  "not_yet_valid",
+			token: key.sign(t, with(func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(time.Hour).Unix() })),
+		},
+		{
+			name:  "wrong_issuer",
+			token: key.sign(t, with(func(c jwt.MapClaims) { c["iss"] = "someone-else" })),
+		},
+		{
+			name:  "wrong_audience",
+			token: key.sign(t, with(func(c jwt.MapClaims) { c["aud"] = "other-product" })),
+		},
+		{
+			name:  "hmac_algorithm_not_accepted",
+			token: createTestJWT(validClaims()),
+		},
+		{
+			name:  "malformed",
+			token: "not-a-valid-jwt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			claims, err := verifier.Verify(context.Background(), tt.token)
+			require.Error(t, err)
+			assert.Nil(t, claims)
+			assert.NotErrorIs(t, err, ErrJWKSUnavailable)
+		})
+	}
+}
+
+func TestJWKSVerifier_KeyRotation(t *testing.T) {
+	t.Parallel()
+
+	oldKey := newRSASigningKey(t, "key-1")
+	newKey := newECSigningKey(t, "key-2")
+
+	server := newJWKSServer(t, oldKey)
+	verifier := NewJWKSVerifier(JWKSConfig{URL: server.URL, MinRefreshInterval: time.Nanosecond})
+
+	_, err := verifier.Verify(context.Background(), oldKey.sign(t, validClaims()))
+	require.NoError(t, err)
+
+	_, err = verifier.Verify(context.Background(), oldKey.sign(t, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), server.fetches.Load(), "cached keys must be reused")
+
+	server.setKeys(t, newKey)
+
+	_, err = verifier.Verify(context.Background(), newKey.sign(t, validClaims()))
+	require.NoError(t, err, "unknown kid must trigger a refetch")
+	assert.Equal(t, int32(2), server.fetches.Load())
+}
+
+func TestJWKSVerifier_StaleKeysServedDuringRefresh(t *testing.T) {
+	t.Parallel()
+
+	key := newRSASigningKey(t, "key-1")
+	server := newJWKSServer(t, key)
+	verifier := NewJWKSVerifier(JWKSConfig{URL: server.URL, RefreshInterval: time.Millisecond, MinRefreshInterval: time.Nanosecond})
+
+	_, err := verifier.Verify(context.Background(), key.sign(t, validClaims()))
+	require.NoError(t, err)
+
+	token := key.sign(t, validClaims())
+	release := server.holdFetches(t)
+
+	time.Sleep(5 * time.Millisecond)
+
+	for range 3 {
+		done := make(chan error, 1)
+
+		go func() {
+			_, err := verifier.Verify(context.Background(), token)
+			done <- err
+		}()
+
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("Verify with a cached key waited for the JWKS refresh")
+		}
+	}
+
+	release()
+
+	assert.Eventually(t, func() bool { return server.fetches.Load() >= 2 }, time.Second, time.Millisecond)
+}
+
+func TestJWKSVerifier_UnknownKidRefreshIsThrottled(t *testing.T) {
+	t.Parallel()
+
+	key := newRSASigningKey(t, "key-1")
+	server := newJWKSServer(t, key)
+	verifier := NewJWKSVerifier(JWKSConfig{URL: server.URL, MinRefreshInterval: time.Hour})
+
+	_, err := verifier.Verify(context.Background(), key.sign(t, validClaims()))
+	require.NoError(t, err)
+
+	unknown := newRSASigningKey(t, "random-kid")
+
+	for range 5 {
+		_, err = verifier.Verify(context.Background(), unknown.sign(t, validClaims()))
+		require.ErrorIs(t, err, ErrUnknownSigningKey)
+	}
+
+	assert.Equal(t, int32(1), server.fetches.Load())
+}
+
+func TestJWKSVerifier_Unavailable(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	verifier := NewJWKSVerifier(JWKSConfig{URL: server.URL})
+
+	_, err := verifier.Verify(context.Background(), newRSASigningKey(t, "k").sign(t, validClaims()))
+	require.ErrorIs(t, err, ErrJWKSUnavailable)
+}
+
+func TestJWKSVerifier_StaticKeys(t *testing.T) {
+	t.Parallel()
+
+	key := newECSigningKey(t, "static")
+	verifier := NewJWKSVerifier(JWKSConfig{JSON: staticJWKS(t, key), URL: "http://unreachable.invalid/jwks.json"})
+
+	claims, err := verifier.Verify(context.Background(), key.sign(t, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, "user123", claims["sub"])
+
+	_, err = verifier.Verify(context.Background(), newECSigningKey(t, "other").sign(t, validClaims()))
+	require.ErrorIs(t, err, ErrUnknownSigningKey)
+
+	_, err = NewJWKSVerifier(JWKSConfig{JSON: []byte(`{"keys":[]}`)}).Verify(context.Background(), key.sign(t, validClaims()))
+	require.ErrorIs(t, err, ErrJWKSUnavailable)
+}
+
+func Test_rawJWK_publicKey_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		raw  rawJWK
+	}{
+		{name: "unsupported_kty", raw: rawJWK{Kty: "oct"}},
+		{name: "rsa_bad_modulus", raw: rawJWK{Kty: "RSA", N: "!!", E: "AQAB"}},
+		{name: "ec_unsupported_curve", raw: rawJWK{Kty: "EC", Crv: "secp256k1"}},
+		{name: "ec_point_not_on_curve", raw: rawJWK{Kty: "EC", Crv: "P-256", X: base64.RawURLEncoding.EncodeToString(make([]byte, 32)), Y: base64.RawURLEncoding.EncodeToString(make([]byte, 32))}},
+		{name: "okp_wrong_size", raw: rawJWK{Kty: "OKP", Crv: "Ed25519", X: "AQID"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := tt.raw.publicKey()
+			require.Error(t, err)
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// AuthClient with Verifier
+// ---------------------------------------------------------------------------
+
+func TestCheckAuthorization_WithVerifier_RejectsForgedTokenLocally(t *testing.T) {
+	t.Parallel()
+
+	key := newRSASigningKey(t, "rsa-1")
+	jwks := newJWKSServer(t, key)
+
+	var authorizeCalls atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		authorizeCalls.Add(1)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(AuthResponse{Authorized: true})
+	}))
+	defer server.Close()
+
+	auth := &AuthClient{
+		Address:  server.URL,
+		Enabled:  true,
+		Logger:   &testLogger{},
+		Verifier: NewJWKSVerifier(JWKSConfig{URL: jwks.URL}),
+	}
+
+	forged := newRSASigningKey(t, "rsa-1").sign(t, validClaims())
+
+	authorized, statusCode, err := auth.checkAuthorization(context.Background(), "midaz", "resource", "read", forged)
+	require.Error(t, err)
+	assert.False(t, authorized)
+	assert.Equal(t, http.StatusUnauthorized, statusCode)
+	assert.Equal(t, int32(0), authorizeCalls.Load(), "auth service must not be called for an invalid token")
+
+	authorized, statusCode, err = auth.checkAuthorization(context.Background(), "midaz", "resource", "read", key.sign(t, validClaims()))
+	require.NoError(t, err)
+	assert.True(t, authorized)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, int32(1), authorizeCalls.Load())
+}
+
+func TestCheckAuthorization_WithVerifier_JWKSUnavailableIsInternalError(t *testing.T) {
+	t.Parallel()
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer jwks.Close()
+
+	auth := &AuthClient{
+		Address:  "http://localhost:9999",
+		Enabled:  true,
+		Logger:   &testLogger{},
+		Verifier: NewJWKSVerifier(JWKSConfig{URL: jwks.URL}),
+	}
+
+	_, statusCode, err := auth.checkAuthorization(context.Background(), "midaz", "resource", "read", newRSASigningKey(t, "k").sign(t, validClaims()))
+	require.ErrorIs(t, err, ErrJWKSUnavailable)
+	assert.Equal(t, http.StatusInternalServerError, statusCode)
+}
+
+func TestNewGRPCAuthUnaryPolicy_WithVerifier_ForgedTenantClaimsRejected(t *testing.T) {
+	t.Parallel()
+
+	jwks := newJWKSServer(t, newRSASigningKey(t, "rsa-1"))
+
+	server := mockAuthServer(t, true, http.StatusOK)
+	defer server.Close()
+
+	auth := &AuthClient{
+		Address:     server.URL,
+		Enabled:     true,
+		Logger:      &testLogger{},
+		Verifier:    NewJWKSVerifier(JWKSConfig{URL: jwks.URL}),
+		MultiTenant: MultiTenantConfig{Enabled: true},
+	}
+
+	claims := validClaims()
+	claims["tenantId"] = "victim-tenant"
+	forged := newRSASigningKey(t, "rsa-1").sign(t, claims)
+
+	defaultPol := Policy{Resource: "res", Action: "read"}
+	interceptor := NewGRPCAuthUnaryPolicy(auth, PolicyConfig{DefaultPolicy: &defaultPol})
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+forged))
+
+	handler := func(_ context.Context, _ any) (any, error) {
+		t.Error("handler must not be called for a forged token")
+		return nil, nil
+	}
+
+	_, err := interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/DoThing"}, handler)
+	require.Error(t, err)
+
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.Unauthenticated, st.Code())
+}
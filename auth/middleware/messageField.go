@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// messageField returns the value of the scalar field at path in the protobuf message req, as a
+// string. path is a dot-separated list of field names, e.g. "ledger.tenant_id"; JSON names
+// ("tenantId") are accepted too. It reports false when req is not a protobuf message, a field
+// does not exist, an intermediate message is unset, or the field is a list, map or message.
+func messageField(req any, path string) (string, bool) {
+	msg, ok := req.(proto.Message)
+	if !ok || path == "" {
+		return "", false
+	}
+
+	m := msg.ProtoReflect()
+	parts := strings.Split(path, ".")
+
+	for i, part := range parts {
+		fields := m.Descriptor().Fields()
+
+		fd := fields.ByName(protoreflect.Name(part))
+		if fd == nil {
+			fd = fields.ByJSONName(part)
+		}
+
+		if fd == nil || fd.IsList() || fd.IsMap() {
+			return "", false
+		}
+
+		last := i == len(parts)-1
+
+		if fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+			if last || !m.Has(fd) {
+				return "", false
+			}
+
+			m = m.Get(fd).Message()
+
+			continue
+		}
+
+		if !last {
+			return "", false
+		}
+
+		return scalarString(fd, m.Get(fd))
+	}
+
+	return "", false
+}
+
+// scalarString formats a scalar protobuf value. Enums are formatted by name.
+func scalarString(fd protoreflect.FieldDescriptor, v protoreflect.Value) (string, bool) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return v.String(), true
+	case protoreflect.BoolKind:
+		return strconv.FormatBool(v.Bool()), true
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name()), true
+		}
+
+		return strconv.FormatInt(int64(v.Enum()), 10), true
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return strconv.FormatInt(v.Int(), 10), true
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return strconv.FormatUint(v.Uint(), 10), true
+	case protoreflect.FloatKind:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), true
+	case protoreflect.DoubleKind:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), true
+	case protoreflect.BytesKind:
+		return string(v.Bytes()), true
+	default:
+		return "", false
+	}
+}
+
+// messageValues converts the protobuf message req into a map keyed by proto field names, e.g. to
+// evaluate conditions against it. Scalars keep their Go type and enums become their name; nested
+// messages become maps and are omitted when unset, lists become slices and map keys are formatted
+// as strings. It returns nil when req is not a protobuf message.
+func messageValues(req any) map[string]any {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil
+	}
+
+	return messageMap(msg.ProtoReflect())
+}
+
+func messageMap(m protoreflect.Message) map[string]any {
+	fields := m.Descriptor().Fields()
+	values := make(map[string]any, fields.Len())
+
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+
+		if fd.Message() != nil && !fd.IsList() && !fd.IsMap() && !m.Has(fd) {
+			continue
+		}
+
+		values[string(fd.Name())] = fieldValue(fd, m.Get(fd))
+	}
+
+	return values
+}
+
+func fieldValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) any {
+	switch {
+	case fd.IsList():
+		list := v.List()
+		items := make([]any, list.Len())
+
+		for i := range list.Len() {
+			items[i] = singularValue(fd, list.Get(i))
+		}
+
+		return items
+	case fd.IsMap():
+		entries := make(map[string]any, v.Map().Len())
+
+		v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+			entries[k.String()] = singularValue(fd.MapValue(), mv)
+
+			return true
+		})
+
+		return entries
+	default:
+		return singularValue(fd, v)
+	}
+}
+
+func singularValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) any {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return messageMap(v.Message())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+
+		return int64(v.Enum())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return v.Int()
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return v.Uint()
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return v.Float()
+	default:
+		return v.Interface()
+	}
+}
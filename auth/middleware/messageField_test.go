@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/apipb"
+	"google.golang.org/protobuf/types/known/sourcecontextpb"
+	"google.golang.org/protobuf/types/known/typepb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestMessageField(t *testing.T) {
+	t.Parallel()
+
+	field := &typepb.Field{
+		Kind:    typepb.Field_TYPE_STRING,
+		Number:  7,
+		Name:    "tenant",
+		TypeUrl: "type.googleapis.com/pkg.Tenant",
+		Packed:  true,
+	}
+
+	api := &apipb.Api{
+		Name:          "pkg.Service",
+		Methods:       []*apipb.Method{{Name: "Get"}},
+		SourceContext: &sourcecontextpb.SourceContext{FileName: "service.proto"},
+	}
+
+	tests := []struct {
+		name   string
+		req    any
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{name: "string", req: field, path: "name", want: "tenant", wantOK: true},
+		{name: "json_name", req: field, path: "typeUrl", want: "type.googleapis.com/pkg.Tenant", wantOK: true},
+		{name: "int", req: field, path: "number", want: "7", wantOK: true},
+		{name: "bool", req: field, path: "packed", want: "true", wantOK: true},
+		{name: "enum_by_name", req: field, path: "kind", want: "TYPE_STRING", wantOK: true},
+		{name: "float", req: wrapperspb.Float(0.1), path: "value", want: "0.1", wantOK: true},
+		{name: "unset_scalar_is_zero", req: field, path: "default_value", want: "", wantOK: true},
+		{name: "nested", req: api, path: "source_context.file_name", want: "service.proto", wantOK: true},
+		{name: "unset_message", req: &apipb.Api{}, path: "source_context.file_name"},
+		{name: "message_field", req: api, path: "source_context"},
+		{name: "list_field", req: api, path: "methods"},
+		{name: "unknown_field", req: field, path: "tenant_id"},
+		{name: "through_scalar", req: field, path: "name.value"},
+		{name: "not_a_message", req: "req", path: "name"},
+		{name: "nil_request", path: "name"},
+		{name: "empty_path", req: field},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := messageField(tt.req, tt.path)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMessageValues(t *testing.T) {
+	t.Parallel()
+
+	api := &apipb.Api{
+		Name:    "pkg.Service",
+		Methods: []*apipb.Method{{Name: "Get", RequestStreaming: true}},
+		Options: []*typepb.Option{{Name: "deprecated"}},
+		Version: "v1",
+	}
+
+	values := messageValues(api)
+	require.NotNil(t, values)
+
+	assert.Equal(t, "pkg.Service", values["name"])
+	assert.Equal(t, "v1", values["version"])
+	assert.Equal(t, "SYNTAX_PROTO2", values["syntax"])
+	assert.NotContains(t, values, "source_context", "unset messages are omitted")
+	assert.Equal(t, []any{}, values["mixins"])
+
+	methods, ok := values["methods"].([]any)
+	require.True(t, ok)
+	require.Len(t, methods, 1)
+
+	method, ok := methods[0].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, "Get", method["name"])
+	assert.Equal(t, true, method["request_streaming"])
+
+	field := messageValues(&typepb.Field{Number: 7, Kind: typepb.Field_TYPE_INT64})
+	assert.Equal(t, int64(7), field["number"])
+	assert.Equal(t, "TYPE_INT64", field["kind"])
+	assert.Equal(t, float32(0.5), float32(messageValues(wrapperspb.Float(0.5))["value"].(float64)))
+	assert.Equal(t, uint64(3), messageValues(wrapperspb.UInt64(3))["value"])
+
+	assert.Nil(t, messageValues("req"))
+	assert.Nil(t, messageValues(nil))
+}
@@ -11,6 +11,8 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	observability "github.com/LerianStudio/lib-observability"
@@ -24,12 +26,59 @@ import (
 	libHTTP "github.com/LerianStudio/lib-commons/v5/commons/net/http"
 	"github.com/gofiber/fiber/v2"
 	jwt "github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
 )
 
+// AuthClient talks to the authorization service.
 type AuthClient struct {
 	Address string
 	Enabled bool
 	Logger  log.Logger
+
+	// Verifier, when set, verifies access tokens locally (signature, exp, nbf, iss, aud) before any
+	// call to the auth service; when nil, tokens are parsed without verification and only the auth
+	// service may decide checks.
+	Verifier *JWKSVerifier
+
+	// Authorizer, when set, decides authorization checks instead of the auth service's /v1/authorize.
+	Authorizer Authorizer
+
+	// DecisionCache, when set, reuses authorization decisions until their TTL elapses.
+	DecisionCache *DecisionCache
+
+	// Retry, when set, retries transient auth service failures with backoff.
+	Retry *RetryConfig
+
+	// Degradation decides the outcome of checks while the auth service is unavailable; routes
+	// (WithRouteDegradation) and gRPC Policies may override it.
+	Degradation DegradationPolicy
+
+	// MultiTenant is filled from MULTI_TENANT_ENABLED by the constructors only; struct literals
+	// must set it explicitly.
+	MultiTenant MultiTenantConfig
+
+	httpClient *http.Client
+	clientOnce sync.Once
+	connStats  connStats
+	tracer     trace.Tracer
+	breaker    *circuitBreaker
+
+	// introspection, when set, requires an active token before every authorization check.
+	introspection *introspector
+
+	// tenantHeaders names the request headers Authorize sets from the tenant claims.
+	tenantHeaders TenantHeaders
+
+	// inflight coalesces concurrent identical authorization checks into a single request.
+	inflight singleflight.Group
+
+	// batchRetryAt is when CheckBatch tries the batch endpoint again (Unix nanoseconds) after the
+	// auth service answered that it has none.
+	batchRetryAt     atomic.Int64
+	batchConcurrency int
+
+	tokenSourcesMu sync.Mutex
+	tokenSources   map[string]*TokenSource
 }
 
 type AuthResponse struct {
@@ -51,19 +100,6 @@ const (
 	pluginName string = "plugin-auth"
 )
 
-// sharedHTTPClient is a package-level HTTP client with a custom transport
-// that prevents HTTP/2 hpack panics under concurrent access. HTTP clients
-// are safe for concurrent use and should be reused across requests.
-var sharedHTTPClient = &http.Client{
-	Timeout: 30 * time.Second,
-	Transport: &http.Transport{
-		ForceAttemptHTTP2:   false,
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 10,
-		IdleConnTimeout:     90 * time.Second,
-	},
-}
-
 // unmarshalErrorResponse unmarshals a JSON response body into commons.Response,
 // tolerating a numeric "code" field (the auth service may return code as a number).
 func unmarshalErrorResponse(body []byte) (commons.Response, error) {
@@ -105,6 +141,14 @@ func logErrorf(ctx context.Context, logger log.Logger, format string, args ...an
 	logger.Log(ctx, log.LevelError, fmt.Sprintf(format, args...))
 }
 
+func logWarnf(ctx context.Context, logger log.Logger, format string, args ...any) {
+	if logger == nil {
+		return
+	}
+
+	logger.Log(ctx, log.LevelWarn, fmt.Sprintf(format, args...))
+}
+
 func logInfof(ctx context.Context, logger log.Logger, format string, args ...any) {
 	if logger == nil {
 		return
@@ -148,79 +192,116 @@ func initializeDefaultLogger() (log.Logger, error) {
 // NewAuthClient creates a new instance of AuthClient.
 // It checks the health of the authorization service if the client is enabled and the address is provided.
 // If the service is healthy, it logs a successful connection message; otherwise, it logs the failure reason.
+// It is kept for compatibility; NewAuthClientWithOptions exposes the full configuration.
 func NewAuthClient(address string, enabled bool, logger *log.Logger) *AuthClient {
-	var l log.Logger
-
-	var err error
+	opts := []Option{WithEnabled(enabled)}
 
 	if logger != nil {
-		l = *logger
-	} else {
-		l, err = initializeDefaultLogger()
-		if err != nil {
-			stdlog.Printf("failed to initialize logger, using NopLogger: %v", err)
-
-			l = log.NewNop()
-		}
+		opts = append(opts, WithLogger(*logger))
 	}
 
-	if !enabled || address == "" {
-		return &AuthClient{
-			Address: address,
-			Enabled: enabled,
-			Logger:  l,
-		}
+	return NewAuthClientWithOptions(address, opts...)
+}
+
+// defaultLogger returns the environment-configured logger, falling back to a NopLogger.
+func defaultLogger() log.Logger {
+	l, err := initializeDefaultLogger()
+	if err != nil {
+		stdlog.Printf("failed to initialize logger, using NopLogger: %v", err)
+
+		return log.NewNop()
 	}
 
-	client := sharedHTTPClient
-	healthURL := fmt.Sprintf("%s/health", address)
+	return l
+}
+
+// checkHealth probes GET <address>/health and logs whether the auth service is reachable and healthy.
+func (auth *AuthClient) checkHealth() {
+	client := auth.client()
+	healthURL := fmt.Sprintf("%s/health", auth.Address)
 
 	failedToConnectMsg := fmt.Sprintf("Failed to connect to %s: %%v\n", pluginName)
 
-	resp, err := client.Get(healthURL)
+	req, err := auth.newRequest(context.Background(), http.MethodGet, healthURL, nil)
+	if err != nil {
+		logErrorf(context.Background(), auth.Logger, failedToConnectMsg, err)
+
+		return
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
-		logErrorf(context.Background(), l, failedToConnectMsg, err)
+		logErrorf(context.Background(), auth.Logger, failedToConnectMsg, err)
 
-		return &AuthClient{Address: address, Enabled: enabled, Logger: l}
+		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		logErrorf(context.Background(), l, failedToConnectMsg, resp.Status)
+		logErrorf(context.Background(), auth.Logger, failedToConnectMsg, resp.Status)
 
-		return &AuthClient{Address: address, Enabled: enabled, Logger: l}
+		return
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logErrorf(context.Background(), l, "Failed to read response body: %v", err)
+		logErrorf(context.Background(), auth.Logger, "Failed to read response body: %v", err)
 
-		return &AuthClient{Address: address, Enabled: enabled, Logger: l}
+		return
 	}
 
 	if string(body) == "healthy" {
-		logInfof(context.Background(), l, "Connected to %s", pluginName)
+		logInfof(context.Background(), auth.Logger, "Connected to %s", pluginName)
 	} else {
-		logErrorf(context.Background(), l, failedToConnectMsg, string(body))
+		logErrorf(context.Background(), auth.Logger, failedToConnectMsg, string(body))
 	}
+}
 
-	return &AuthClient{
-		Address: address,
-		Enabled: enabled,
-		Logger:  l,
+// tracking returns the tracer and request ID for ctx. The client's own tracer,
+// set through WithTracerProvider, takes precedence over the one carried in ctx.
+func (auth *AuthClient) tracking(ctx context.Context) (trace.Tracer, string) {
+	_, tracer, reqID, _ := observability.NewTrackingFromContext(ctx)
+
+	if auth != nil && auth.tracer != nil {
+		tracer = auth.tracer
 	}
+
+	return tracer, reqID
 }
 
 // Authorize is a middleware function for the Fiber framework that checks if a user is authorized to perform a specific action on a resource.
 // product identifies the product/application owning the route (e.g. "midaz"); it builds the M2M role and is forwarded for user-flow isolation.
+// resource may be a template such as "ledgers/:ledger_id/accounts/:id", resolved from the route params and forwarded as
+// the concrete resource ("ledgers/123/accounts/456"); requests with an empty or invalid param get 400.
 // If the user is authorized, the request is passed to the next handler; otherwise, a 403 Forbidden status is returned.
-func (auth *AuthClient) Authorize(product, resource, action string) fiber.Handler {
+// Authorized requests carry the caller's Principal, available through PrincipalFromFiber and PrincipalFromContext(c.UserContext()).
+// With MultiTenant enabled they also carry the token's Tenant (TenantFromFiber, TenantFromContext) and the
+// tenant headers configured with WithTenantHeaders, and tokens of another tenant than the requested one get 403.
+// opts override per-route settings such as the DegradationPolicy or the tenant guard (WithTenantGuard),
+// or add a condition (WithCondition).
+func (auth *AuthClient) Authorize(product, resource, action string, opts ...AuthorizeOption) fiber.Handler {
+	var route authorizeConfig
+
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&route)
+		}
+	}
+
+	template := isResourceTemplate(resource)
+
+	if route.condition != "" {
+		if err := ValidateCondition(route.condition); err != nil {
+			logErrorf(context.Background(), auth.Logger, "Invalid condition for %s %s: %v", resource, action, err)
+		}
+	}
+
 	return func(c *fiber.Ctx) error {
 		ctx := tracing.ExtractHTTPContext(c.UserContext(), c)
 
-		_, tracer, reqID, _ := observability.NewTrackingFromContext(ctx)
+		tracer, reqID := auth.tracking(ctx)
 
-		if !auth.Enabled || auth.Address == "" {
+		if !auth.enforcing() {
 			return c.Next()
 		}
 
@@ -238,7 +319,22 @@ func (auth *AuthClient) Authorize(product, resource, action string) fiber.Handle
 			return c.Status(http.StatusUnauthorized).SendString("Missing Token")
 		}
 
-		if authorized, statusCode, err := auth.checkAuthorization(ctx, product, resource, action, accessToken); err != nil {
+		target := resource
+
+		if template {
+			var (
+				statusCode int
+				err        error
+			)
+
+			if target, statusCode, err = auth.resolveFiberResource(ctx, span, c, resource); err != nil {
+				span.End()
+
+				return c.Status(statusCode).SendString(http.StatusText(statusCode))
+			}
+		}
+
+		if principal, authorized, statusCode, err := auth.authorizeToken(ctx, product, target, action, accessToken, route.degradation); err != nil {
 			var commonsErr commons.Response
 			if errors.As(err, &commonsErr) {
 				span.End()
@@ -250,8 +346,28 @@ func (auth *AuthClient) Authorize(product, resource, action string) fiber.Handle
 
 			return c.Status(statusCode).SendString(http.StatusText(statusCode))
 		} else if authorized {
+			if route.condition != "" {
+				if met, err := auth.meetsCondition(ctx, route.condition, principal, fiberConditionRequest(c)); err != nil {
+					span.End()
+
+					return c.Status(http.StatusInternalServerError).SendString(http.StatusText(http.StatusInternalServerError))
+				} else if !met {
+					span.End()
+
+					return c.Status(http.StatusForbidden).SendString("Forbidden")
+				}
+			}
+
+			if statusCode, err := auth.propagateFiberTenant(ctx, c, span, principal, route.tenantGuard); err != nil {
+				span.End()
+
+				return c.Status(statusCode).SendString(http.StatusText(statusCode))
+			}
+
 			span.End()
 
+			setFiberPrincipal(c, principal)
+
 			return c.Next()
 		}
 
@@ -261,10 +377,6 @@ func (auth *AuthClient) Authorize(product, resource, action string) fiber.Handle
 	}
 }
 
-// checkAuthorization sends an authorization request to the external service and returns whether the action is authorized.
-// product identifies the product/plugin owning the route. The subject is derived from it: M2M tokens map to the product's
-// editor role, while normal users are identified by their JWT (owner/userId) and the product is forwarded so the auth
-// service can isolate permissions by product. Empty product keeps the previous behavior.
 // deriveSubject builds the authorization subject from the token claims.
 // For M2M tokens it is the product's editor role ("admin/<product>-editor-role");
 // for normal-user tokens it is the JWT identity ("<owner>/<userID>"), failing
@@ -299,17 +411,45 @@ func (auth *AuthClient) deriveSubject(ctx context.Context, span trace.Span, clai
 	return fmt.Sprintf("%s/%s", owner, userID), http.StatusOK, nil
 }
 
+// checkAuthorization sends an authorization request to the external service and returns whether the action is authorized.
+// product identifies the product/plugin owning the route. The subject is derived from it: M2M tokens map to the product's
+// editor role, while normal users are identified by their JWT (owner/userId) and the product is forwarded so the auth
+// service can isolate permissions by product. Empty product keeps the previous behavior.
 func (auth *AuthClient) checkAuthorization(ctx context.Context, product, resource, action, accessToken string) (bool, int, error) {
-	_, tracer, reqID, _ := observability.NewTrackingFromContext(ctx)
+	_, authorized, statusCode, err := auth.authorizeToken(ctx, product, resource, action, accessToken, nil)
 
-	ctx, span := tracer.Start(ctx, "lib_auth.check_authorization")
-	defer span.End()
+	return authorized, statusCode, err
+}
 
-	span.SetAttributes(
-		attribute.String("app.request.request_id", reqID),
-	)
+// parseClaims returns the claims of accessToken. With a Verifier configured the token is
+// verified locally and rejected with 401 when invalid (500 when the JWKS is unavailable);
+// otherwise it is parsed without verification and the auth service remains the authority. A
+// custom Authorizer is not such an authority, so without a Verifier it fails with 500.
+func (auth *AuthClient) parseClaims(ctx context.Context, span trace.Span, accessToken string) (jwt.MapClaims, int, error) {
+	if auth.Verifier != nil {
+		claims, err := auth.Verifier.Verify(ctx, accessToken)
+		if err != nil {
+			logErrorf(ctx, auth.Logger, "Failed to verify token: %v", err)
+
+			tracing.HandleSpanError(span, "Failed to verify token", err)
+
+			if errors.Is(err, ErrJWKSUnavailable) {
+				return nil, http.StatusInternalServerError, err
+			}
+
+			return nil, http.StatusUnauthorized, err
+		}
+
+		return claims, http.StatusOK, nil
+	}
 
-	client := sharedHTTPClient
+	if !auth.remoteAuthority() {
+		logErrorf(ctx, auth.Logger, "Custom Authorizer without a Verifier: configure WithJWKS")
+
+		tracing.HandleSpanError(span, "Custom Authorizer without a Verifier", ErrVerifierRequired)
+
+		return nil, http.StatusInternalServerError, ErrVerifierRequired
+	}
 
 	token, _, err := new(jwt.Parser).ParseUnverified(accessToken, jwt.MapClaims{})
 	if err != nil {
@@ -317,7 +457,7 @@ func (auth *AuthClient) checkAuthorization(ctx context.Context, product, resourc
 
 		tracing.HandleSpanError(span, "Failed to parse token", err)
 
-		return false, http.StatusUnauthorized, err
+		return nil, http.StatusUnauthorized, err
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
@@ -328,33 +468,150 @@ func (auth *AuthClient) checkAuthorization(ctx context.Context, product, resourc
 
 		tracing.HandleSpanError(span, "Failed to parse claims", err)
 
-		return false, http.StatusUnauthorized, err
+		return nil, http.StatusUnauthorized, err
+	}
+
+	return claims, http.StatusOK, nil
+}
+
+// authenticate parses (or verifies) accessToken, requires it to be active when introspection is
+// configured and derives the Principal for product. It returns the HTTP status to reject the
+// request with on error.
+func (auth *AuthClient) authenticate(ctx context.Context, span trace.Span, product, accessToken string) (*Principal, int, error) {
+	claims, statusCode, err := auth.parseClaims(ctx, span, accessToken)
+	if err != nil {
+		return nil, statusCode, err
+	}
+
+	if auth.introspection != nil {
+		if statusCode, err := auth.requireActive(ctx, span, accessToken); err != nil {
+			return nil, statusCode, err
+		}
 	}
 
 	userType, _ := claims["type"].(string)
 
 	sub, statusCode, err := auth.deriveSubject(ctx, span, claims, userType, product)
 	if err != nil {
-		return false, statusCode, err
+		return nil, statusCode, err
 	}
 
-	requestBody := map[string]string{
-		"sub":      sub,
-		"resource": resource,
-		"action":   action,
+	return newPrincipal(claims, sub), http.StatusOK, nil
+}
+
+// authorizeToken is checkAuthorization returning the authenticated Principal as well, so
+// callers that need the claims (e.g. tenant propagation) do not parse or verify the token twice.
+// The decision comes from the client's Authorizer; when it is unavailable, degradation (or the
+// client's policy when nil) applies.
+func (auth *AuthClient) authorizeToken(ctx context.Context, product, resource, action, accessToken string, degradation *DegradationPolicy) (*Principal, bool, int, error) {
+	tracer, reqID := auth.tracking(ctx)
+
+	ctx, span := tracer.Start(ctx, "lib_auth.check_authorization")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("app.request.request_id", reqID),
+	)
+
+	principal, statusCode, err := auth.authenticate(ctx, span, product, accessToken)
+	if err != nil {
+		return nil, false, statusCode, err
 	}
 
-	if userType == normalUser && product != "" {
-		requestBody["product"] = product
+	cacheKey := newDecisionKey(principal.Subject, product, resource, action, accessToken)
+
+	if auth.DecisionCache != nil {
+		authorized, hit := auth.DecisionCache.get(cacheKey)
+
+		span.SetAttributes(attribute.Bool("app.auth.decision_cache.hit", hit))
+
+		if hit {
+			return principal, authorized, http.StatusOK, nil
+		}
 	}
 
-	err = tracing.SetSpanAttributesFromValue(span, "app.request.payload", requestBody, nil)
-	if err != nil {
-		tracing.HandleSpanError(span, "Failed to convert request body to JSON string", err)
+	ch := auth.inflight.DoChan(cacheKey.String(), func() (any, error) {
+		// The shared request must not be aborted when the caller that started it goes away while
+		// others still wait on it, so it is detached from cancellation but keeps the deadline.
+		sharedCtx, cancel := detachedContext(ctx)
+		defer cancel()
+
+		decision, err := auth.authorizer().Check(sharedCtx, Request{
+			Principal: principal,
+			Product:   product,
+			Resource:  resource,
+			Action:    action,
+			Token:     accessToken,
+		})
+		switch {
+		case decision.StatusCode != 0:
+		case err != nil:
+			decision.StatusCode = http.StatusInternalServerError
+		default:
+			decision.StatusCode = http.StatusOK
+		}
 
-		return false, http.StatusInternalServerError, err
+		return authorizationResult{authorized: decision.Authorized, statusCode: decision.StatusCode}, err
+	})
+
+	var res singleflight.Result
+
+	select {
+	case res = <-ch:
+	case <-ctx.Done():
+		tracing.HandleSpanError(span, "Authorization request canceled", ctx.Err())
+
+		return nil, false, http.StatusInternalServerError, fmt.Errorf("failed to make request: %w", ctx.Err())
+	}
+
+	span.SetAttributes(attribute.Bool("app.auth.coalesced", res.Shared))
+
+	result, _ := res.Val.(authorizationResult)
+	if result.statusCode >= http.StatusInternalServerError {
+		if authorized, ok := auth.degrade(ctx, span, degradation, cacheKey); ok {
+			return principal, authorized, http.StatusOK, nil
+		}
+	}
+
+	if res.Err != nil {
+		return nil, false, result.statusCode, res.Err
+	}
+
+	if auth.DecisionCache != nil && result.statusCode == http.StatusOK {
+		auth.DecisionCache.set(cacheKey, result.authorized, tokenExpiry(principal.Claims))
+	}
+
+	return principal, result.authorized, result.statusCode, nil
+}
+
+// tokenExpiry returns the "exp" claim, or the zero time when absent.
+func tokenExpiry(claims jwt.MapClaims) time.Time {
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		return exp.Time
+	}
+
+	return time.Time{}
+}
+
+// detachedContext returns a context carrying ctx's values and deadline but not its cancellation.
+func detachedContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
 	}
 
+	return context.WithCancel(detached)
+}
+
+// authorizationResult carries the outcome of an Authorizer check through the in-flight group.
+type authorizationResult struct {
+	authorized bool
+	statusCode int
+}
+
+// requestAuthorization performs the POST to /v1/authorize and interprets the response.
+func (auth *AuthClient) requestAuthorization(ctx context.Context, span trace.Span, requestBody map[string]string, accessToken string) (bool, int, error) {
 	requestBodyJSON, err := json.Marshal(requestBody)
 	if err != nil {
 		logErrorf(ctx, auth.Logger, "Failed to marshal request body: %v", err)
@@ -364,7 +621,7 @@ func (auth *AuthClient) checkAuthorization(ctx context.Context, product, resourc
 		return false, http.StatusInternalServerError, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/v1/authorize", auth.Address), bytes.NewBuffer(requestBodyJSON))
+	req, err := auth.newRequest(ctx, http.MethodPost, fmt.Sprintf("%s/v1/authorize", auth.Address), bytes.NewBuffer(requestBodyJSON))
 	if err != nil {
 		logErrorf(ctx, auth.Logger, "Failed to create request: %v", err)
 
@@ -378,12 +635,16 @@ func (auth *AuthClient) checkAuthorization(ctx context.Context, product, resourc
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", accessToken)
 
-	resp, err := client.Do(req)
+	resp, err := auth.do(span, req)
 	if err != nil {
 		logErrorf(ctx, auth.Logger, "Failed to make request: %v", err)
 
 		tracing.HandleSpanError(span, "Failed to make request", err)
 
+		if errors.Is(err, ErrCircuitOpen) {
+			return false, http.StatusServiceUnavailable, err
+		}
+
 		return false, http.StatusInternalServerError, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
@@ -429,8 +690,21 @@ func (auth *AuthClient) checkAuthorization(ctx context.Context, product, resourc
 // GetApplicationToken sends a POST request to the authorization service to get a token for the application.
 // It takes the client ID and client secret as parameters and returns the access token if the request is successful.
 // If the request fails at any step, an error is returned with a descriptive message.
+// Use GetApplicationTokenResponse for the expiry, refresh token and scope of the issued token.
 func (auth *AuthClient) GetApplicationToken(ctx context.Context, clientID, clientSecret string) (string, error) {
-	_, tracer, reqID, _ := observability.NewTrackingFromContext(ctx)
+	token, err := auth.GetApplicationTokenResponse(ctx, clientID, clientSecret)
+	if err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, nil
+}
+
+// GetApplicationTokenResponse requests a token for the application with the client credentials grant,
+// optionally limited to scopes, and returns the full token response. Rejections by the auth service
+// are returned as *TokenError. Disabled clients return an empty token.
+func (auth *AuthClient) GetApplicationTokenResponse(ctx context.Context, clientID, clientSecret string, scopes ...string) (*ApplicationToken, error) {
+	tracer, reqID := auth.tracking(ctx)
 
 	ctx, span := tracer.Start(ctx, "lib_auth.get_application_token")
 	defer span.End()
@@ -440,11 +714,9 @@ func (auth *AuthClient) GetApplicationToken(ctx context.Context, clientID, clien
 	)
 
 	if !auth.Enabled || auth.Address == "" {
-		return "", nil
+		return &ApplicationToken{}, nil
 	}
 
-	client := sharedHTTPClient
-
 	requestBody := map[string]string{
 		"grantType":    "client_credentials",
 		"clientId":     clientID,
@@ -458,11 +730,127 @@ func (auth *AuthClient) GetApplicationToken(ctx context.Context, clientID, clien
 		"clientId":  clientID,
 	}
 
+	if len(scopes) > 0 {
+		requestBody["scope"] = strings.Join(scopes, " ")
+		tracePayload["scope"] = requestBody["scope"]
+	}
+
+	return auth.requestToken(ctx, span, requestBody, tracePayload)
+}
+
+// RefreshApplicationToken exchanges refreshToken for a new token with the refresh_token grant.
+// The client credentials authenticate the client, as for GetApplicationTokenResponse. Rejections,
+// e.g. of an expired or revoked refresh token, are returned as *TokenError. The request is never
+// retried (see WithRetry), since the auth service may have rotated refreshToken before failing.
+// Disabled clients return an empty token.
+func (auth *AuthClient) RefreshApplicationToken(ctx context.Context, clientID, clientSecret, refreshToken string) (*ApplicationToken, error) {
+	tracer, reqID := auth.tracking(ctx)
+
+	ctx, span := tracer.Start(ctx, "lib_auth.refresh_application_token")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("app.request.request_id", reqID),
+	)
+
+	if !auth.Enabled || auth.Address == "" {
+		return &ApplicationToken{}, nil
+	}
+
+	requestBody := map[string]string{
+		"grantType":    "refresh_token",
+		"clientId":     clientID,
+		"clientSecret": clientSecret,
+		"refreshToken": refreshToken,
+	}
+
+	// tracePayload omits clientSecret and refreshToken so credentials never flow into telemetry.
+	tracePayload := map[string]string{
+		"grantType": "refresh_token",
+		"clientId":  clientID,
+	}
+
+	return auth.requestToken(withoutRetry(ctx), span, requestBody, tracePayload)
+}
+
+// RevokeToken revokes an access or refresh token (RFC 7009). tokenTypeHint is "access_token",
+// "refresh_token" or empty. As the RFC prescribes, revoking an unknown or already invalid token
+// succeeds. Cached authorization decisions and introspection results for the token are dropped.
+// Like RefreshApplicationToken, it is never retried.
+func (auth *AuthClient) RevokeToken(ctx context.Context, clientID, clientSecret, token, tokenTypeHint string) error {
+	tracer, reqID := auth.tracking(ctx)
+
+	ctx, span := tracer.Start(ctx, "lib_auth.revoke_token")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("app.request.request_id", reqID),
+	)
+
+	if !auth.Enabled || auth.Address == "" {
+		return nil
+	}
+
+	requestBody := map[string]string{
+		"clientId":     clientID,
+		"clientSecret": clientSecret,
+		"token":        token,
+	}
+
+	// tracePayload omits clientSecret and token so credentials never flow into telemetry.
+	tracePayload := map[string]string{
+		"clientId": clientID,
+	}
+
+	if tokenTypeHint != "" {
+		requestBody["tokenTypeHint"] = tokenTypeHint
+		tracePayload["tokenTypeHint"] = tokenTypeHint
+	}
+
+	if _, _, err := auth.postOAuth(withoutRetry(ctx), span, "/v1/login/oauth/revoke", requestBody, tracePayload); err != nil {
+		return err
+	}
+
+	if auth.DecisionCache != nil {
+		auth.DecisionCache.purgeToken(token)
+	}
+
+	if auth.introspection != nil {
+		auth.introspection.cache.purgeToken(token)
+	}
+
+	return nil
+}
+
+// requestToken posts requestBody to the token endpoint and decodes the issued token.
+// tracePayload is recorded on the span instead of requestBody, which carries secrets.
+func (auth *AuthClient) requestToken(ctx context.Context, span trace.Span, requestBody, tracePayload map[string]string) (*ApplicationToken, error) {
+	body, receivedAt, err := auth.postOAuth(ctx, span, "/v1/login/oauth/access_token", requestBody, tracePayload)
+	if err != nil {
+		return nil, err
+	}
+
+	var response oauth2Token
+	if err := json.Unmarshal(body, &response); err != nil {
+		logErrorf(ctx, auth.Logger, "Failed to unmarshal response: %v", err)
+
+		tracing.HandleSpanError(span, "Failed to unmarshal response", err)
+
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return newApplicationToken(response, receivedAt), nil
+}
+
+// postOAuth posts requestBody to an OAuth endpoint of the auth service and returns the response body
+// and the time it was received. Non-2xx responses are returned as *TokenError. tracePayload is
+// recorded on the span instead of requestBody, which carries secrets.
+func (auth *AuthClient) postOAuth(ctx context.Context, span trace.Span, path string, requestBody, tracePayload map[string]string) ([]byte, time.Time, error) {
 	err := tracing.SetSpanAttributesFromValue(span, "app.request.payload", tracePayload, nil)
 	if err != nil {
 		tracing.HandleSpanError(span, "Failed to convert request body to JSON string", err)
 
-		return "", fmt.Errorf("failed to convert request body to JSON string: %w", err)
+		return nil, time.Time{}, fmt.Errorf("failed to convert request body to JSON string: %w", err)
 	}
 
 	requestBodyJSON, err := json.Marshal(requestBody)
@@ -471,66 +859,66 @@ func (auth *AuthClient) GetApplicationToken(ctx context.Context, clientID, clien
 
 		tracing.HandleSpanError(span, "Failed to marshal request body", err)
 
-		return "", fmt.Errorf("failed to marshal request body: %w", err)
+		return nil, time.Time{}, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/v1/login/oauth/access_token", auth.Address), bytes.NewBuffer(requestBodyJSON))
+	req, err := auth.newRequest(ctx, http.MethodPost, auth.Address+path, bytes.NewBuffer(requestBodyJSON))
 	if err != nil {
 		logErrorf(ctx, auth.Logger, "Failed to create request: %v", err)
 
 		tracing.HandleSpanError(span, "Failed to create request", err)
 
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, time.Time{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	tracing.InjectHTTPContext(ctx, req.Header)
 
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := client.Do(req)
+	resp, err := auth.do(span, req)
 	if err != nil {
 		logErrorf(ctx, auth.Logger, "Failed to make request: %v", err)
 
 		tracing.HandleSpanError(span, "Failed to make request", err)
 
-		return "", fmt.Errorf("failed to make request: %w", err)
+		return nil, time.Time{}, fmt.Errorf("failed to make request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	receivedAt := time.Now()
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		logErrorf(ctx, auth.Logger, "Failed to read response body: %v", err)
 
 		tracing.HandleSpanError(span, "Failed to read response body", err)
 
-		return "", fmt.Errorf("failed to read response body: %w", err)
+		return nil, time.Time{}, fmt.Errorf("failed to read response body: %w", err)
 	}
 
-	respError, err := unmarshalErrorResponse(body)
-	if err != nil {
-		logErrorf(ctx, auth.Logger, "Failed to unmarshal auth error response: %v", err)
-
-		tracing.HandleSpanError(span, "Failed to unmarshal auth error response", err)
-
-		return "", fmt.Errorf("failed to unmarshal auth error response: %w", err)
-	}
+	var respError commons.Response
 
-	if respError.Code != "" && resp.StatusCode != http.StatusInternalServerError {
-		logErrorf(ctx, auth.Logger, "Failed to get application token: %s", respError.Message)
+	// Successful revocations may come back without a body.
+	if len(body) > 0 {
+		respError, err = unmarshalErrorResponse(body)
+		if err != nil {
+			logErrorf(ctx, auth.Logger, "Failed to unmarshal auth error response: %v", err)
 
-		tracing.HandleSpanError(span, "Failed to get application token", respError)
+			tracing.HandleSpanError(span, "Failed to unmarshal auth error response", err)
 
-		return "", respError
+			return nil, time.Time{}, fmt.Errorf("failed to unmarshal auth error response: %w", err)
+		}
 	}
 
-	var response oauth2Token
-	if err := json.Unmarshal(body, &response); err != nil {
-		logErrorf(ctx, auth.Logger, "Failed to unmarshal response: %v", err)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		logErrorf(ctx, auth.Logger, "OAuth request to %s failed: %s", path, respError.Message)
 
-		tracing.HandleSpanError(span, "Failed to unmarshal response", err)
+		tokenErr := &TokenError{StatusCode: resp.StatusCode, Response: respError}
+
+		tracing.HandleSpanError(span, "OAuth request failed", tokenErr)
 
-		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+		return nil, time.Time{}, tokenErr
 	}
 
-	return response.AccessToken, nil
+	return body, receivedAt, nil
 }
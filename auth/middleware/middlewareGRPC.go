@@ -2,17 +2,14 @@ package middleware
 
 import (
 	"context"
-	"errors"
-	"fmt"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/LerianStudio/lib-commons/v5/commons"
-	observability "github.com/LerianStudio/lib-observability"
 	"github.com/LerianStudio/lib-observability/tracing"
 	jwt "github.com/golang-jwt/jwt/v5"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
@@ -22,8 +19,26 @@ import (
 // Policy defines the authorization target within the authz domain.
 // Keep minimal to avoid leaking service semantics across layers.
 type Policy struct {
+	// Resource may be a template such as "ledgers/:ledger_id/accounts/:id", resolved from the fields
+	// of unary request messages (nested as "ledger.id") and forwarded as the concrete resource.
 	Resource string
 	Action   string
+
+	// Degradation, when set, overrides the client's DegradationPolicy for this policy.
+	Degradation *DegradationPolicy
+
+	// TenantGuard, when set, rejects calls targeting another tenant than the token's, overriding
+	// MultiTenantConfig.Match; it applies even when multi-tenancy is disabled.
+	TenantGuard *TenantSource
+
+	// Scopes and Claims are required of the token locally after the remote check, like RequireScopes
+	// and RequireClaims. A policy with only Scopes, Claims or Condition does not call the auth
+	// service and needs a Verifier on the AuthClient.
+	Scopes []string
+	Claims map[string]string
+
+	// Condition is a CEL expression the call must also meet, evaluated locally last (see ValidateCondition).
+	Condition string
 }
 
 // PolicyConfig binds gRPC methods to Policies and optional product resolution.
@@ -33,28 +48,45 @@ type Policy struct {
 //   to checkAuthorization as its product argument. For M2M tokens it becomes the
 //   subject "admin/<product>-editor-role"; for normal-user tokens it is forwarded
 //   for product isolation. Return "" when not applicable.
+// - MultiTenant, when set, overrides the client's MultiTenantConfig for these interceptors.
+// - PolicyResolver, when set, resolves the Policy per call (see PolicyFromMessage); ErrNoPolicy falls back to the above.
 type PolicyConfig struct {
 	MethodPolicies map[string]Policy
 	DefaultPolicy  *Policy
 	SubResolver    func(ctx context.Context, fullMethod string, req any) (string, error)
+	MultiTenant    *MultiTenantConfig
+	PolicyResolver PolicyResolver
+}
+
+// multiTenant returns the MultiTenantConfig in effect: cfg.MultiTenant, or the client's.
+func (cfg PolicyConfig) multiTenant(auth *AuthClient) MultiTenantConfig {
+	if cfg.MultiTenant != nil {
+		return *cfg.MultiTenant
+	}
+
+	return auth.MultiTenant
 }
 
 // NewGRPCAuthUnaryPolicy authorizes unary RPCs via per-method Policy.
 // Behavior:
-// - Resolves the Policy by info.FullMethod; falls back to DefaultPolicy when provided.
+// - Resolves the Policy with cfg.PolicyResolver, or by info.FullMethod; falls back to DefaultPolicy when provided.
 // - Optionally derives the product using cfg.SubResolver (e.g., "midaz"). Empty product is valid.
 // - Rejects missing tokens with codes.Unauthenticated; misconfiguration returns codes.Internal.
+// - Stores the caller's Principal in the handler context (see PrincipalFromContext).
+// - Enforces and propagates the tenant claims per cfg.MultiTenant or the client's MultiTenantConfig.
 // Telemetry:
 // - Sets app.request.request_id.
 // - Sets app.request.payload with {product, resource, action} per standard.
 func NewGRPCAuthUnaryPolicy(auth *AuthClient, cfg PolicyConfig) grpc.UnaryServerInterceptor {
+	cfg.checkLocalPolicies(auth)
+
 	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
-		if auth == nil || !auth.Enabled || auth.Address == "" {
+		if auth == nil || !auth.enforcing() {
 			return handler(ctx, req)
 		}
 
 		token, ok := extractTokenFromMD(ctx)
-		_, tracer, reqID, _ := observability.NewTrackingFromContext(ctx)
+		tracer, reqID := auth.tracking(ctx)
 
 		ctx, span := tracer.Start(ctx, "lib_auth.authorize_grpc_unary_policy")
 		defer span.End()
@@ -65,11 +97,9 @@ func NewGRPCAuthUnaryPolicy(auth *AuthClient, cfg PolicyConfig) grpc.UnaryServer
 			return nil, status.Error(codes.Unauthenticated, "missing token")
 		}
 
-		pol, found := policyForMethod(cfg, info.FullMethod)
-		if !found {
-			tracing.HandleSpanError(span, "no policy configured for method", fmt.Errorf("%s", info.FullMethod))
-
-			return nil, status.Error(codes.Internal, "internal configuration error")
+		pol, err := cfg.resolvePolicy(ctx, span, info.FullMethod, req)
+		if err != nil {
+			return nil, err
 		}
 
 		// product is the resolved product identifier passed as checkAuthorization's
@@ -87,6 +117,15 @@ func NewGRPCAuthUnaryPolicy(auth *AuthClient, cfg PolicyConfig) grpc.UnaryServer
 			}
 		}
 
+		if isResourceTemplate(pol.Resource) {
+			resource, err := auth.resolveGRPCResource(ctx, span, pol.Resource, req)
+			if err != nil {
+				return nil, err
+			}
+
+			pol.Resource = resource
+		}
+
 		payload := map[string]string{
 			"product":  product,
 			"resource": pol.Resource,
@@ -96,7 +135,12 @@ func NewGRPCAuthUnaryPolicy(auth *AuthClient, cfg PolicyConfig) grpc.UnaryServer
 			tracing.HandleSpanError(span, "failed to set span payload", err)
 		}
 
-		authorized, httpStatus, err := auth.checkAuthorization(ctx, product, pol.Resource, pol.Action, token)
+		var request map[string]any
+		if pol.Condition != "" {
+			request = grpcConditionRequest(ctx, info.FullMethod, req)
+		}
+
+		principal, authorized, httpStatus, err := auth.authorizePolicy(ctx, product, pol, token, request)
 		if err != nil {
 			return nil, grpcErrorFromHTTP(httpStatus)
 		}
@@ -105,27 +149,14 @@ func NewGRPCAuthUnaryPolicy(auth *AuthClient, cfg PolicyConfig) grpc.UnaryServer
 			return nil, status.Error(codes.PermissionDenied, "forbidden")
 		}
 
-		// Propagate tenant claims if multi-tenant mode is enabled
-		if os.Getenv("MULTI_TENANT_ENABLED") == "true" {
-			tenantID, tenantSlug, tOwner, _ := extractTenantClaims(token)
-			md, _ := metadata.FromIncomingContext(ctx)
-			md = md.Copy()
-
-			if tenantID != "" {
-				md.Set("md-tenant-id", tenantID)
-			}
-
-			if tenantSlug != "" {
-				md.Set("md-tenant-slug", tenantSlug)
-			}
-
-			if tOwner != "" {
-				md.Set("md-tenant-owner", tOwner)
-			}
-
-			ctx = metadata.NewIncomingContext(ctx, md)
+		// Enforce and propagate the tenant claims if multi-tenant mode is enabled
+		ctx, err = auth.propagateGRPCTenant(ctx, span, cfg.multiTenant(auth), principal, pol.TenantGuard, req)
+		if err != nil {
+			return nil, err
 		}
 
+		ctx = ContextWithPrincipal(ctx, principal)
+
 		return handler(ctx, req)
 	}
 }
@@ -184,6 +215,8 @@ func grpcErrorFromHTTP(httpStatus int) error {
 		return status.Error(codes.Unauthenticated, "unauthenticated")
 	case http.StatusForbidden:
 		return status.Error(codes.PermissionDenied, "forbidden")
+	case http.StatusServiceUnavailable:
+		return status.Error(codes.Unavailable, "authorization service unavailable")
 	default:
 		return status.Error(codes.Internal, "internal error")
 	}
@@ -209,35 +242,29 @@ func SubFromMetadata(key string) func(ctx context.Context, fullMethod string, re
 	}
 }
 
-// extractTenantClaims extracts tenant-related claims from a JWT without signature verification.
+// extractTenantClaims extracts tenant-related claims from already parsed token claims.
 // Returns tenantID, tenantSlug, and owner from the token's custom claims.
-// Used by gRPC interceptors to propagate tenant context to downstream services.
-func extractTenantClaims(tokenString string) (tenantID, tenantSlug, owner string, err error) {
-	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
-	if err != nil {
-		return "", "", "", err
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return "", "", "", errors.New("invalid token claims")
-	}
-
+// Used to build the Principal with the default claim names; the claims come from authorizeToken,
+// so they are verified whenever the AuthClient has a Verifier.
+func extractTenantClaims(claims jwt.MapClaims) (tenantID, tenantSlug, owner string) {
 	tenantID, _ = claims["tenantId"].(string)
 	tenantSlug, _ = claims["tenantSlug"].(string)
 	owner, _ = claims["owner"].(string)
 
-	return tenantID, tenantSlug, owner, nil
+	return tenantID, tenantSlug, owner
 }
 
 // NewGRPCAuthStreamPolicy authorizes streaming RPCs via per-method Policy.
 // Mirrors NewGRPCAuthUnaryPolicy behavior for streaming calls:
 // - Resolves Policy by info.FullMethod; falls back to DefaultPolicy.
 // - Rejects missing tokens with codes.Unauthenticated.
-// - Propagates tenant claims when MULTI_TENANT_ENABLED=true.
+// - Enforces and propagates the tenant claims per cfg.MultiTenant or the client's MultiTenantConfig.
+// - Stores the caller's Principal in the stream context (see PrincipalFromContext).
 func NewGRPCAuthStreamPolicy(auth *AuthClient, cfg PolicyConfig) grpc.StreamServerInterceptor {
+	cfg.checkLocalPolicies(auth)
+
 	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-		if auth == nil || !auth.Enabled || auth.Address == "" {
+		if auth == nil || !auth.enforcing() {
 			return handler(srv, ss)
 		}
 
@@ -248,9 +275,9 @@ func NewGRPCAuthStreamPolicy(auth *AuthClient, cfg PolicyConfig) grpc.StreamServ
 			return status.Error(codes.Unauthenticated, "missing token")
 		}
 
-		pol, found := policyForMethod(cfg, info.FullMethod)
-		if !found {
-			return status.Error(codes.Internal, "internal configuration error")
+		pol, err := cfg.resolvePolicy(ctx, trace.SpanFromContext(ctx), info.FullMethod, nil)
+		if err != nil {
+			return err
 		}
 
 		// product is the resolved product identifier passed as checkAuthorization's
@@ -266,7 +293,21 @@ func NewGRPCAuthStreamPolicy(auth *AuthClient, cfg PolicyConfig) grpc.StreamServ
 			}
 		}
 
-		authorized, httpStatus, err := auth.checkAuthorization(ctx, product, pol.Resource, pol.Action, token)
+		if isResourceTemplate(pol.Resource) {
+			resource, err := auth.resolveGRPCResource(ctx, trace.SpanFromContext(ctx), pol.Resource, nil)
+			if err != nil {
+				return err
+			}
+
+			pol.Resource = resource
+		}
+
+		var request map[string]any
+		if pol.Condition != "" {
+			request = grpcConditionRequest(ctx, info.FullMethod, nil)
+		}
+
+		principal, authorized, httpStatus, err := auth.authorizePolicy(ctx, product, pol, token, request)
 		if err != nil {
 			return grpcErrorFromHTTP(httpStatus)
 		}
@@ -275,29 +316,13 @@ func NewGRPCAuthStreamPolicy(auth *AuthClient, cfg PolicyConfig) grpc.StreamServ
 			return status.Error(codes.PermissionDenied, "forbidden")
 		}
 
-		// Propagate tenant claims if multi-tenant mode is enabled
-		if os.Getenv("MULTI_TENANT_ENABLED") == "true" {
-			tenantID, tenantSlug, tOwner, _ := extractTenantClaims(token)
-			md, _ := metadata.FromIncomingContext(ctx)
-			md = md.Copy()
-
-			if tenantID != "" {
-				md.Set("md-tenant-id", tenantID)
-			}
-
-			if tenantSlug != "" {
-				md.Set("md-tenant-slug", tenantSlug)
-			}
-
-			if tOwner != "" {
-				md.Set("md-tenant-owner", tOwner)
-			}
-
-			ctx = metadata.NewIncomingContext(ctx, md)
-			ss = &wrappedServerStream{ServerStream: ss, ctx: ctx}
+		// Enforce and propagate the tenant claims if multi-tenant mode is enabled
+		ctx, err = auth.propagateGRPCTenant(ctx, trace.SpanFromContext(ctx), cfg.multiTenant(auth), principal, pol.TenantGuard, nil)
+		if err != nil {
+			return err
 		}
 
-		return handler(srv, ss)
+		return handler(srv, &wrappedServerStream{ServerStream: ss, ctx: ContextWithPrincipal(ctx, principal)})
 	}
 }
 
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCClientConfig configures how outgoing gRPC calls are authenticated.
+// - ForwardIncomingToken sends the caller's incoming token, when present, instead of the application token (on-behalf-of calls).
+// - AllowInsecure lets the PerRPCCredentials be used over connections without transport security.
+type GRPCClientConfig struct {
+	ForwardIncomingToken bool
+	AllowInsecure        bool
+}
+
+// outgoingToken returns the token for an outgoing call and whether it was forwarded from the
+// incoming metadata. An empty token means the AuthClient is disabled.
+func outgoingToken(ctx context.Context, source *TokenSource, cfg GRPCClientConfig) (string, bool, error) {
+	if cfg.ForwardIncomingToken {
+		if token, ok := extractTokenFromMD(ctx); ok {
+			return token, true, nil
+		}
+	}
+
+	token, err := source.Token(ctx)
+	if err != nil {
+		return "", false, status.Error(codes.Unauthenticated, fmt.Sprintf("failed to get application token: %v", err))
+	}
+
+	return token, false, nil
+}
+
+// hasOutgoingAuthorization reports whether the caller already set an authorization header.
+func hasOutgoingAuthorization(ctx context.Context) bool {
+	md, ok := metadata.FromOutgoingContext(ctx)
+
+	return ok && len(md.Get("authorization")) > 0
+}
+
+// withOutgoingToken adds the bearer token to the outgoing metadata.
+func withOutgoingToken(ctx context.Context, token string) context.Context {
+	if token == "" {
+		return ctx
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+// NewGRPCAuthUnaryClientInterceptor attaches "authorization: Bearer <token>" to outgoing unary calls.
+// Behavior:
+// - Uses the application token from source, cached and refreshed by the TokenSource.
+// - Forwards the caller's incoming token instead when cfg.ForwardIncomingToken is set.
+// - Keeps an authorization header already present in the outgoing metadata.
+// - Retries once with a fresh application token when the call fails with codes.Unauthenticated.
+func NewGRPCAuthUnaryClientInterceptor(source *TokenSource, cfg GRPCClientConfig) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if hasOutgoingAuthorization(ctx) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		token, forwarded, err := outgoingToken(ctx, source, cfg)
+		if err != nil {
+			return err
+		}
+
+		err = invoker(withOutgoingToken(ctx, token), method, req, reply, cc, opts...)
+		if token == "" || forwarded || status.Code(err) != codes.Unauthenticated {
+			return err
+		}
+
+		source.invalidate(token)
+
+		freshToken, tokenErr := source.Token(ctx)
+		if tokenErr != nil {
+			return err
+		}
+
+		return invoker(withOutgoingToken(ctx, freshToken), method, req, reply, cc, opts...)
+	}
+}
+
+// NewGRPCAuthStreamClientInterceptor attaches "authorization: Bearer <token>" to outgoing streams.
+// Mirrors NewGRPCAuthUnaryClientInterceptor, without the retry on codes.Unauthenticated.
+func NewGRPCAuthStreamClientInterceptor(source *TokenSource, cfg GRPCClientConfig) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if hasOutgoingAuthorization(ctx) {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		token, _, err := outgoingToken(ctx, source, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		return streamer(withOutgoingToken(ctx, token), desc, cc, method, opts...)
+	}
+}
+
+// grpcTokenCredentials implements credentials.PerRPCCredentials with a TokenSource.
+type grpcTokenCredentials struct {
+	source *TokenSource
+	cfg    GRPCClientConfig
+}
+
+// NewGRPCPerRPCCredentials returns credentials for grpc.WithPerRPCCredentials that send the
+// application token from source (or the forwarded incoming token, see GRPCClientConfig) on every call.
+func NewGRPCPerRPCCredentials(source *TokenSource, cfg GRPCClientConfig) credentials.PerRPCCredentials {
+	return &grpcTokenCredentials{source: source, cfg: cfg}
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.
+func (c *grpcTokenCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	token, _, err := outgoingToken(ctx, c.source, c.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if token == "" {
+		return nil, nil
+	}
+
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+func (c *grpcTokenCredentials) RequireTransportSecurity() bool {
+	return !c.cfg.AllowInsecure
+}
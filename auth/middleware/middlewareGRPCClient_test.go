@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// recordingInvoker captures the outgoing authorization header of every call and fails with
+// codes.Unauthenticated while the header is in rejected.
+type recordingInvoker struct {
+	rejected map[string]bool
+	headers  []string
+}
+
+func (r *recordingInvoker) invoke(ctx context.Context, _ string, _, _ any, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+	md, _ := metadata.FromOutgoingContext(ctx)
+
+	var header string
+	if vals := md.Get("authorization"); len(vals) > 0 {
+		header = vals[0]
+	}
+
+	r.headers = append(r.headers, header)
+
+	if r.rejected[header] {
+		return status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+
+	return nil
+}
+
+func incomingToken(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+// ---------------------------------------------------------------------------
+// NewGRPCAuthUnaryClientInterceptor
+// ---------------------------------------------------------------------------
+
+func TestNewGRPCAuthUnaryClientInterceptor(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		cfg         GRPCClientConfig
+		rejected    []string
+		wantErr     codes.Code
+		wantHeaders []string
+	}{
+		{
+			name:        "attaches_application_token",
+			ctx:         context.Background(),
+			wantHeaders: []string{"Bearer token-1"},
+		},
+		{
+			name:        "ignores_incoming_token_by_default",
+			ctx:         incomingToken("user-token"),
+			wantHeaders: []string{"Bearer token-1"},
+		},
+		{
+			name:        "forwards_incoming_token",
+			ctx:         incomingToken("user-token"),
+			cfg:         GRPCClientConfig{ForwardIncomingToken: true},
+			wantHeaders: []string{"Bearer user-token"},
+		},
+		{
+			name:        "forwarding_falls_back_to_application_token",
+			ctx:         context.Background(),
+			cfg:         GRPCClientConfig{ForwardIncomingToken: true},
+			wantHeaders: []string{"Bearer token-1"},
+		},
+		{
+			name:        "keeps_explicit_authorization",
+			ctx:         metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer explicit"),
+			wantHeaders: []string{"Bearer explicit"},
+		},
+		{
+			name:        "retries_once_with_fresh_token",
+			ctx:         context.Background(),
+			rejected:    []string{"Bearer token-1"},
+			wantHeaders: []string{"Bearer token-1", "Bearer token-2"},
+		},
+		{
+			name:        "does_not_retry_forwarded_token",
+			ctx:         incomingToken("user-token"),
+			cfg:         GRPCClientConfig{ForwardIncomingToken: true},
+			rejected:    []string{"Bearer user-token"},
+			wantErr:     codes.Unauthenticated,
+			wantHeaders: []string{"Bearer user-token"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newTokenServer(t, 3600, "")
+
+			source := tokenClient(server.URL).TokenSource("client", "secret")
+			t.Cleanup(source.Close)
+
+			invoker := &recordingInvoker{rejected: map[string]bool{}}
+			for _, header := range tt.rejected {
+				invoker.rejected[header] = true
+			}
+
+			interceptor := NewGRPCAuthUnaryClientInterceptor(source, tt.cfg)
+
+			err := interceptor(tt.ctx, "/pkg.Service/DoThing", "req", nil, nil, invoker.invoke)
+			assert.Equal(t, tt.wantErr, status.Code(err))
+			assert.Equal(t, tt.wantHeaders, invoker.headers)
+		})
+	}
+}
+
+func TestNewGRPCAuthUnaryClientInterceptor_TokenError(t *testing.T) {
+	t.Parallel()
+
+	server := newTokenServer(t, 3600, "")
+	server.Close()
+
+	source := tokenClient(server.URL).TokenSource("client", "secret")
+	t.Cleanup(source.Close)
+
+	invoker := &recordingInvoker{}
+
+	err := NewGRPCAuthUnaryClientInterceptor(source, GRPCClientConfig{})(context.Background(), "/pkg.Service/DoThing", "req", nil, nil, invoker.invoke)
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Empty(t, invoker.headers)
+}
+
+// ---------------------------------------------------------------------------
+// NewGRPCAuthStreamClientInterceptor
+// ---------------------------------------------------------------------------
+
+func TestNewGRPCAuthStreamClientInterceptor(t *testing.T) {
+	t.Parallel()
+
+	server := newTokenServer(t, 3600, "")
+
+	source := tokenClient(server.URL).TokenSource("client", "secret")
+	t.Cleanup(source.Close)
+
+	var header string
+
+	streamer := func(ctx context.Context, _ *grpc.StreamDesc, _ *grpc.ClientConn, _ string, _ ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		header = md.Get("authorization")[0]
+
+		return nil, nil
+	}
+
+	interceptor := NewGRPCAuthStreamClientInterceptor(source, GRPCClientConfig{})
+
+	_, err := interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/pkg.Service/Stream", streamer)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer token-1", header)
+}
+
+// ---------------------------------------------------------------------------
+// NewGRPCPerRPCCredentials
+// ---------------------------------------------------------------------------
+
+func TestNewGRPCPerRPCCredentials(t *testing.T) {
+	t.Parallel()
+
+	server := newTokenServer(t, 3600, "")
+
+	source := tokenClient(server.URL).TokenSource("client", "secret")
+	t.Cleanup(source.Close)
+
+	creds := NewGRPCPerRPCCredentials(source, GRPCClientConfig{})
+
+	md, err := creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer token-1"}, md)
+	assert.True(t, creds.RequireTransportSecurity())
+
+	forwarding := NewGRPCPerRPCCredentials(source, GRPCClientConfig{ForwardIncomingToken: true, AllowInsecure: true})
+
+	md, err = forwarding.GetRequestMetadata(incomingToken("user-token"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer user-token"}, md)
+	assert.False(t, forwarding.RequireTransportSecurity())
+}
+
+func TestNewGRPCPerRPCCredentials_DisabledClient(t *testing.T) {
+	t.Parallel()
+
+	auth := NewAuthClientWithOptions("http://plugin-auth:4000", WithEnabled(false), WithLogger(&testLogger{}))
+
+	md, err := NewGRPCPerRPCCredentials(auth.TokenSource("client", "secret"), GRPCClientConfig{}).GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, md)
+}
@@ -199,6 +199,12 @@ func Test_grpcErrorFromHTTP(t *testing.T) {
 			wantCode:   codes.PermissionDenied,
 			wantMsg:    "forbidden",
 		},
+		{
+			name:       "503_maps_to_unavailable",
+			httpStatus: http.StatusServiceUnavailable,
+			wantCode:   codes.Unavailable,
+			wantMsg:    "authorization service unavailable",
+		},
 		{
 			name:       "500_maps_to_internal",
 			httpStatus: http.StatusInternalServerError,
@@ -567,72 +573,64 @@ func Test_extractTenantClaims(t *testing.T) {
 
 	tests := []struct {
 		name           string
-		tokenString    string
+		claims         jwt.MapClaims
 		wantTenantID   string
 		wantTenantSlug string
 		wantOwner      string
-		wantErr        bool
 	}{
 		{
-			name: "valid_jwt_with_all_tenant_claims",
-			tokenString: createTestJWT(jwt.MapClaims{
+			name: "all_tenant_claims",
+			claims: jwt.MapClaims{
 				"tenantId":   "tid-123",
 				"tenantSlug": "acme-corp",
 				"owner":      "owner-456",
-			}),
+			},
 			wantTenantID:   "tid-123",
 			wantTenantSlug: "acme-corp",
 			wantOwner:      "owner-456",
-			wantErr:        false,
 		},
 		{
-			name: "jwt_with_only_owner",
-			tokenString: createTestJWT(jwt.MapClaims{
+			name: "only_owner",
+			claims: jwt.MapClaims{
 				"owner": "owner-only",
-			}),
+			},
 			wantTenantID:   "",
 			wantTenantSlug: "",
 			wantOwner:      "owner-only",
-			wantErr:        false,
 		},
 		{
-			name: "jwt_with_only_tenantId",
-			tokenString: createTestJWT(jwt.MapClaims{
+			name: "only_tenantId",
+			claims: jwt.MapClaims{
 				"tenantId": "tid-only",
-			}),
+			},
 			wantTenantID:   "tid-only",
 			wantTenantSlug: "",
 			wantOwner:      "",
-			wantErr:        false,
 		},
 		{
-			name:           "invalid_token",
-			tokenString:    "not.a.valid.jwt",
+			name: "non_string_claims_are_ignored",
+			claims: jwt.MapClaims{
+				"tenantId":   123,
+				"tenantSlug": true,
+				"owner":      []string{"x"},
+			},
 			wantTenantID:   "",
 			wantTenantSlug: "",
 			wantOwner:      "",
-			wantErr:        true,
 		},
 		{
-			name:           "empty_token",
-			tokenString:    "",
+			name:           "nil_claims",
+			claims:         nil,
 			wantTenantID:   "",
 			wantTenantSlug: "",
 			wantOwner:      "",
-			wantErr:        true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			tenantID, tenantSlug, owner, err := extractTenantClaims(tt.tokenString)
-
-			if tt.wantErr {
-				require.Error(t, err)
-			} else {
-				require.NoError(t, err)
-			}
+			tenantID, tenantSlug, owner := extractTenantClaims(tt.claims)
 
 			assert.Equal(t, tt.wantTenantID, tenantID)
 			assert.Equal(t, tt.wantTenantSlug, tenantSlug)
@@ -646,18 +644,19 @@ func Test_extractTenantClaims(t *testing.T) {
 // ---------------------------------------------------------------------------
 
 func TestNewGRPCAuthUnaryPolicy_TenantPropagation(t *testing.T) {
-	// Cannot use t.Parallel() because subtests use t.Setenv which modifies process env.
+	t.Parallel()
 
 	t.Run("multi_tenant_enabled_propagates_tenant_metadata", func(t *testing.T) {
-		t.Setenv("MULTI_TENANT_ENABLED", "true")
+		t.Parallel()
 
 		server := mockAuthServer(t, true, http.StatusOK)
 		defer server.Close()
 
 		auth := &AuthClient{
-			Address: server.URL,
-			Enabled: true,
-			Logger:  &testLogger{},
+			Address:     server.URL,
+			Enabled:     true,
+			Logger:      &testLogger{},
+			MultiTenant: MultiTenantConfig{Enabled: true},
 		}
 
 		token := createTestJWT(jwt.MapClaims{
@@ -699,7 +698,7 @@ func TestNewGRPCAuthUnaryPolicy_TenantPropagation(t *testing.T) {
 	})
 
 	t.Run("multi_tenant_disabled_no_tenant_metadata", func(t *testing.T) {
-		t.Setenv("MULTI_TENANT_ENABLED", "false")
+		t.Parallel()
 
 		server := mockAuthServer(t, true, http.StatusOK)
 		defer server.Close()
@@ -764,7 +763,7 @@ func (f *fakeServerStream) Context() context.Context {
 }
 
 func TestNewGRPCAuthStreamPolicy(t *testing.T) {
-	// Cannot use t.Parallel() because a subtest uses t.Setenv which modifies process env.
+	t.Parallel()
 
 	dummyInfo := &grpc.StreamServerInfo{
 		FullMethod: "/pkg.Service/StreamThing",
@@ -863,15 +862,16 @@ func TestNewGRPCAuthStreamPolicy(t *testing.T) {
 	})
 
 	t.Run("multi_tenant_enabled_propagates_tenant_metadata_in_stream", func(t *testing.T) {
-		t.Setenv("MULTI_TENANT_ENABLED", "true")
+		t.Parallel()
 
 		server := mockAuthServer(t, true, http.StatusOK)
 		defer server.Close()
 
 		auth := &AuthClient{
-			Address: server.URL,
-			Enabled: true,
-			Logger:  &testLogger{},
+			Address:     server.URL,
+			Enabled:     true,
+			Logger:      &testLogger{},
+			MultiTenant: MultiTenantConfig{Enabled: true},
 		}
 
 		token := createTestJWT(jwt.MapClaims{
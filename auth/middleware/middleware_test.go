@@ -3,10 +3,15 @@ package middleware
 import (
 	"context"
 	"encoding/json"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	observability "github.com/LerianStudio/lib-observability"
 	"github.com/LerianStudio/lib-observability/log"
@@ -22,7 +27,7 @@ import (
 // ---------------------------------------------------------------------------
 
 // createTestJWT builds a signed JWT string for testing.
-// checkAuthorization uses ParseUnverified so the signing key does not matter.
+// Without a Verifier, checkAuthorization uses ParseUnverified so the signing key does not matter.
 func createTestJWT(claims jwt.MapClaims) string {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
@@ -35,6 +40,19 @@ func createTestJWT(claims jwt.MapClaims) string {
 	return signed
 }
 
+// userClaims returns the claims of user1 in the acme organization, with extra claims merged in.
+func userClaims(extra ...jwt.MapClaims) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"type": "normal-user", "owner": "acme", "sub": "user1", "scope": "ledgers:read accounts:read", "aud": []any{"midaz", "reporter"},
+	}
+
+	for _, e := range extra {
+		maps.Copy(claims, e)
+	}
+
+	return claims
+}
+
 // mockAuthServer returns an httptest.Server that responds to POST /v1/authorize.
 func mockAuthServer(t *testing.T, authorized bool, statusCode int) *httptest.Server {
 	t.Helper()
@@ -52,6 +70,97 @@ func mockAuthServer(t *testing.T, authorized bool, statusCode int) *httptest.Ser
 	}))
 }
 
+// authServer is a fake auth service that answers /health with "healthy" and authorizes every other
+// request, counting both and recording the resources asked for. failFirst scripts failures of the
+// next requests.
+type authServer struct {
+	*httptest.Server
+
+	calls        atomic.Int32
+	healthChecks atomic.Int32
+
+	// down makes every authorization request fail with 503 while set.
+	down atomic.Bool
+
+	mu         sync.Mutex
+	failures   int32
+	failStatus int
+	failHeader http.Header
+	resources  []string
+}
+
+func newAuthServer(t *testing.T) *authServer {
+	t.Helper()
+
+	s := &authServer{}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			s.healthChecks.Add(1)
+
+			_, _ = w.Write([]byte("healthy"))
+
+			return
+		}
+
+		s.calls.Add(1)
+
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("auth server: request must carry its body: %v", err)
+		}
+
+		s.mu.Lock()
+		s.resources = append(s.resources, body["resource"])
+		fail := s.failures > 0
+		if fail {
+			s.failures--
+		}
+		failStatus, failHeader := s.failStatus, s.failHeader
+		s.mu.Unlock()
+
+		switch {
+		case s.down.Load():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case fail && failStatus == 0:
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("auth server: failed to hijack connection: %v", err)
+
+				return
+			}
+
+			_ = conn.Close()
+		case fail:
+			maps.Copy(w.Header(), failHeader)
+			w.WriteHeader(failStatus)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(AuthResponse{Authorized: true})
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// failFirst fails the next n requests with status and header, or by dropping the connection
+// when status is 0.
+func (s *authServer) failFirst(n int32, status int, header http.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures, s.failStatus, s.failHeader = n, status, header
+}
+
+// recorded returns the resources of the authorization requests received so far.
+func (s *authServer) recorded() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.resources)
+}
+
 // testLogger is a minimal log.Logger implementation for tests that discards all output.
 type testLogger struct{}
 
@@ -509,6 +618,120 @@ func TestCheckAuthorization_ServerReturnsInvalidJSON(t *testing.T) {
 	assert.Contains(t, err.Error(), "failed to unmarshal")
 }
 
+func TestCheckAuthorization_CoalescesConcurrentIdenticalChecks(t *testing.T) {
+	t.Parallel()
+
+	const callers = 10
+
+	var calls atomic.Int32
+
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		<-release
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(AuthResponse{Authorized: true})
+	}))
+	defer server.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { require.NoError(t, tp.Shutdown(context.Background())) })
+
+	auth := &AuthClient{
+		Address: server.URL,
+		Enabled: true,
+		Logger:  &testLogger{},
+	}
+
+	token := createTestJWT(jwt.MapClaims{
+		"type":  "normal-user",
+		"owner": "org1",
+		"sub":   "user1",
+	})
+
+	ctx := observability.ContextWithTracer(context.Background(), tp.Tracer("test"))
+
+	var wg sync.WaitGroup
+
+	results := make(chan bool, callers)
+
+	for range callers {
+		wg.Go(func() {
+			authorized, _, err := auth.checkAuthorization(ctx, "midaz", "ledgers", "get", token)
+			assert.NoError(t, err)
+
+			results <- authorized
+		})
+	}
+
+	// Let every caller join the in-flight request before the server answers.
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	wg.Wait()
+	close(results)
+
+	for authorized := range results {
+		assert.True(t, authorized)
+	}
+
+	assert.Equal(t, int32(1), calls.Load(), "identical concurrent checks must share one request")
+
+	coalesced := 0
+
+	for _, span := range exporter.GetSpans() {
+		for _, attr := range span.Attributes {
+			if attr.Key == "app.auth.coalesced" && attr.Value.AsBool() {
+				coalesced++
+			}
+		}
+	}
+
+	assert.Equal(t, callers, coalesced)
+}
+
+func TestCheckAuthorization_DifferentTokensAreNotCoalesced(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		<-release
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(AuthResponse{Authorized: true})
+	}))
+	defer server.Close()
+
+	auth := &AuthClient{
+		Address: server.URL,
+		Enabled: true,
+		Logger:  &testLogger{},
+	}
+
+	var wg sync.WaitGroup
+
+	for _, sub := range []string{"user1", "user2"} {
+		token := createTestJWT(jwt.MapClaims{"type": "normal-user", "owner": "org1", "sub": sub})
+
+		wg.Go(func() {
+			_, _, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+			assert.NoError(t, err)
+		})
+	}
+
+	require.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+}
+
 // ---------------------------------------------------------------------------
 // GetApplicationToken
 // ---------------------------------------------------------------------------
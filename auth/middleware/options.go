@@ -0,0 +1,276 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/LerianStudio/lib-observability/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope used when a TracerProvider is configured on the client.
+const tracerName = "lib-auth"
+
+// Option configures an AuthClient built by NewAuthClientWithOptions.
+type Option func(*authClientConfig)
+
+// authClientConfig collects options before the AuthClient is assembled, so options can be
+// passed in any order (e.g. WithTimeout before or after WithHTTPClient).
+type authClientConfig struct {
+	enabled          bool
+	logger           log.Logger
+	httpClient       *http.Client
+	timeout          time.Duration
+	tracerProvider   trace.TracerProvider
+	healthCheck      bool
+	jwks             *JWKSConfig
+	authorizer       Authorizer
+	decisionCache    *DecisionCacheConfig
+	retry            *RetryConfig
+	circuitBreaker   *CircuitBreakerConfig
+	degradation      DegradationPolicy
+	introspection    *IntrospectionConfig
+	tenantHeaders    TenantHeaders
+	multiTenant      *MultiTenantConfig
+	batchConcurrency int
+}
+
+// WithEnabled toggles authorization. Disabled clients let every request through. Defaults to true.
+func WithEnabled(enabled bool) Option {
+	return func(c *authClientConfig) {
+		c.enabled = enabled
+	}
+}
+
+// WithLogger sets the logger. Defaults to a zap logger configured from ENV_NAME.
+func WithLogger(logger log.Logger) Option {
+	return func(c *authClientConfig) {
+		c.logger = logger
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to reach the auth service. By default each
+// AuthClient owns a client with its own connection pool and a 30s timeout.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *authClientConfig) {
+		c.httpClient = client
+	}
+}
+
+// WithTimeout sets the overall timeout of each request to the auth service.
+// When combined with WithHTTPClient, the timeout is applied to a copy of that client.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *authClientConfig) {
+		c.timeout = timeout
+	}
+}
+
+// WithTracerProvider sets the TracerProvider for lib-auth spans, overriding the tracer carried in the request context.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *authClientConfig) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithHealthCheck toggles the GET /health probe performed at construction. Defaults to true.
+func WithHealthCheck(enabled bool) Option {
+	return func(c *authClientConfig) {
+		c.healthCheck = enabled
+	}
+}
+
+// WithJWKS enables local token verification. Without cfg.JSON, an empty cfg.URL defaults to
+// "<address>/.well-known/jwks.json". An empty cfg.HTTPClient defaults to the client's own.
+func WithJWKS(cfg JWKSConfig) Option {
+	return func(c *authClientConfig) {
+		c.jwks = &cfg
+	}
+}
+
+// WithAuthorizer makes authorization checks ask authorizer instead of the auth service's
+// /v1/authorize. Checks are enforced with it even without an address. It requires WithJWKS: only
+// the auth service checks that tokens are genuine, so requests fail with 500 without a Verifier.
+func WithAuthorizer(authorizer Authorizer) Option {
+	return func(c *authClientConfig) {
+		c.authorizer = authorizer
+	}
+}
+
+// WithDecisionCache enables the authorization decision cache.
+func WithDecisionCache(cfg DecisionCacheConfig) Option {
+	return func(c *authClientConfig) {
+		c.decisionCache = &cfg
+	}
+}
+
+// WithRetry enables retries of transient auth service failures. Refresh and revocation requests
+// are never retried.
+func WithRetry(cfg RetryConfig) Option {
+	return func(c *authClientConfig) {
+		c.retry = &cfg
+	}
+}
+
+// WithCircuitBreaker wraps calls to the auth service in a circuit breaker.
+func WithCircuitBreaker(cfg CircuitBreakerConfig) Option {
+	return func(c *authClientConfig) {
+		c.circuitBreaker = &cfg
+	}
+}
+
+// WithDegradation sets the default DegradationPolicy applied while the auth service is unavailable.
+// Defaults to FailClosed.
+func WithDegradation(policy DegradationPolicy) Option {
+	return func(c *authClientConfig) {
+		c.degradation = policy
+	}
+}
+
+// WithIntrospection requires every authorization check to find the token active through
+// introspection before calling /v1/authorize.
+func WithIntrospection(cfg IntrospectionConfig) Option {
+	return func(c *authClientConfig) {
+		c.introspection = &cfg
+	}
+}
+
+// WithTenantHeaders makes Authorize set the tenant claims as request headers for downstream
+// proxies when MultiTenantConfig.Enabled is set.
+func WithTenantHeaders(headers TenantHeaders) Option {
+	return func(c *authClientConfig) {
+		c.tenantHeaders = headers
+	}
+}
+
+// WithMultiTenant configures tenant propagation and enforcement. Without it, multi-tenancy is
+// enabled with the defaults when MULTI_TENANT_ENABLED=true at construction.
+func WithMultiTenant(cfg MultiTenantConfig) Option {
+	return func(c *authClientConfig) {
+		c.multiTenant = &cfg
+	}
+}
+
+// WithBatchConcurrency bounds the concurrent checks CheckBatch makes when the auth service has no
+// batch endpoint. Defaults to 8.
+func WithBatchConcurrency(n int) Option {
+	return func(c *authClientConfig) {
+		c.batchConcurrency = n
+	}
+}
+
+// resolveHTTPClient returns the configured client with the timeout applied to a copy of it,
+// or a new client with its own connection pool when WithHTTPClient was not given.
+func (c *authClientConfig) resolveHTTPClient(stats *connStats) *http.Client {
+	if c.httpClient == nil {
+		timeout := c.timeout
+		if timeout <= 0 {
+			timeout = defaultHTTPTimeout
+		}
+
+		return newHTTPClient(timeout, stats)
+	}
+
+	if c.timeout <= 0 {
+		return c.httpClient
+	}
+
+	client := *c.httpClient
+	client.Timeout = c.timeout
+
+	return &client
+}
+
+// NewAuthClientWithOptions creates a new instance of AuthClient configured by opts.
+// Unless disabled with WithHealthCheck(false), it checks the health of the authorization service
+// when the client is enabled and the address is provided, logging the outcome.
+func NewAuthClientWithOptions(address string, opts ...Option) *AuthClient {
+	cfg := &authClientConfig{
+		enabled:     true,
+		healthCheck: true,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cfg)
+		}
+	}
+
+	if cfg.logger == nil {
+		cfg.logger = defaultLogger()
+	}
+
+	auth := &AuthClient{
+		Address:     address,
+		Enabled:     cfg.enabled,
+		Logger:      cfg.logger,
+		Degradation: cfg.degradation,
+		Authorizer:  cfg.authorizer,
+
+		tenantHeaders:    cfg.tenantHeaders,
+		batchConcurrency: cfg.batchConcurrency,
+	}
+
+	auth.httpClient = cfg.resolveHTTPClient(&auth.connStats)
+
+	if cfg.multiTenant != nil {
+		auth.MultiTenant = *cfg.multiTenant
+	} else {
+		auth.MultiTenant.Enabled = os.Getenv("MULTI_TENANT_ENABLED") == "true"
+	}
+
+	if cfg.tracerProvider != nil {
+		auth.tracer = cfg.tracerProvider.Tracer(tracerName)
+	}
+
+	if cfg.jwks != nil {
+		jwksCfg := *cfg.jwks
+		if jwksCfg.URL == "" && jwksCfg.JSON == nil {
+			jwksCfg.URL = strings.TrimRight(address, "/") + "/.well-known/jwks.json"
+		}
+
+		if jwksCfg.HTTPClient == nil {
+			jwksCfg.HTTPClient = auth.client()
+		}
+
+		verifier := NewJWKSVerifier(jwksCfg)
+		if verifier.staticErr != nil {
+			logErrorf(context.Background(), auth.Logger, "Invalid static JWKS: %v: tokens are rejected", verifier.staticErr)
+		}
+
+		auth.Verifier = verifier
+	}
+
+	if cfg.decisionCache != nil {
+		auth.DecisionCache = NewDecisionCache(*cfg.decisionCache)
+	}
+
+	if cfg.retry != nil {
+		retry := cfg.retry.withDefaults()
+		auth.Retry = &retry
+	}
+
+	if cfg.circuitBreaker != nil {
+		auth.breaker = auth.newCircuitBreaker(*cfg.circuitBreaker)
+	}
+
+	if cfg.introspection != nil {
+		auth.introspection = newIntrospector(*cfg.introspection)
+	}
+
+	if auth.Enabled && auth.Verifier == nil && !auth.remoteAuthority() {
+		logErrorf(context.Background(), auth.Logger, "WithAuthorizer requires WithJWKS: requests are rejected until tokens can be verified")
+	}
+
+	if auth.Enabled && auth.Verifier == nil && auth.Degradation.Mode == FailOpen {
+		logErrorf(context.Background(), auth.Logger, "FailOpen requires WithJWKS: checks fail closed while the auth service is unavailable")
+	}
+
+	if cfg.healthCheck && auth.Enabled && address != "" {
+		auth.checkHealth()
+	}
+
+	return auth
+}
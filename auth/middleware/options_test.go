@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LerianStudio/lib-observability/log"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// countingTransport counts round trips before delegating to http.DefaultTransport.
+type countingTransport struct {
+	calls atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.calls.Add(1)
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewAuthClientWithOptions_Defaults(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+
+	auth := NewAuthClientWithOptions(server.URL, WithLogger(&testLogger{}))
+
+	assert.True(t, auth.Enabled)
+	assert.Equal(t, server.URL, auth.Address)
+	assert.NotNil(t, auth.Logger)
+	assert.Nil(t, auth.Verifier)
+	assert.Nil(t, auth.DecisionCache)
+	assert.Equal(t, defaultHTTPTimeout, auth.client().Timeout)
+	assert.Equal(t, int32(1), server.healthChecks.Load())
+}
+
+func TestNewAuthClientWithOptions_HealthCheck(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		wantProbes int32
+	}{
+		{name: "disabled_by_option", opts: []Option{WithHealthCheck(false)}, wantProbes: 0},
+		{name: "skipped_when_client_disabled", opts: []Option{WithEnabled(false)}, wantProbes: 0},
+		{name: "nil_option_is_ignored", opts: []Option{nil}, wantProbes: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newAuthServer(t)
+
+			NewAuthClientWithOptions(server.URL, append(tt.opts, WithLogger(&testLogger{}))...)
+
+			assert.Equal(t, tt.wantProbes, server.healthChecks.Load())
+		})
+	}
+}
+
+func TestNewAuthClientWithOptions_HTTPClientAndTimeout(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+	transport := &countingTransport{}
+	custom := &http.Client{Transport: transport}
+
+	auth := NewAuthClientWithOptions(server.URL,
+		WithTimeout(5*time.Second),
+		WithHTTPClient(custom),
+		WithLogger(&testLogger{}),
+	)
+
+	assert.Equal(t, 5*time.Second, auth.client().Timeout)
+	assert.Same(t, transport, auth.client().Transport)
+	assert.Zero(t, custom.Timeout, "the caller's client must not be mutated")
+
+	token := createTestJWT(jwt.MapClaims{"type": "normal-user", "owner": "org1", "sub": "user1"})
+
+	authorized, _, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+	require.NoError(t, err)
+	assert.True(t, authorized)
+
+	// One health probe plus one authorization request.
+	assert.Equal(t, int32(2), transport.calls.Load())
+}
+
+func TestNewAuthClientWithOptions_TimeoutWithoutHTTPClient(t *testing.T) {
+	t.Parallel()
+
+	auth := NewAuthClientWithOptions("", WithTimeout(time.Second), WithLogger(&testLogger{}))
+
+	assert.Equal(t, time.Second, auth.client().Timeout)
+}
+
+func TestNewAuthClientWithOptions_TracerProvider(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { require.NoError(t, tp.Shutdown(context.Background())) })
+
+	auth := NewAuthClientWithOptions(server.URL, WithTracerProvider(tp), WithLogger(&testLogger{}))
+
+	token := createTestJWT(jwt.MapClaims{"type": "normal-user", "owner": "org1", "sub": "user1"})
+
+	_, _, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "lib_auth.check_authorization", spans[0].Name)
+	assert.Equal(t, tracerName, spans[0].InstrumentationScope.Name)
+}
+
+func TestNewAuthClientWithOptions_JWKSAndDecisionCache(t *testing.T) {
+	t.Parallel()
+
+	auth := NewAuthClientWithOptions("http://plugin-auth:4000/",
+		WithHealthCheck(false),
+		WithJWKS(JWKSConfig{Issuer: "plugin-auth"}),
+		WithDecisionCache(DecisionCacheConfig{MaxEntries: 10}),
+		WithLogger(&testLogger{}),
+	)
+
+	require.NotNil(t, auth.Verifier)
+	assert.Equal(t, "http://plugin-auth:4000/.well-known/jwks.json", auth.Verifier.cfg.URL)
+	assert.Equal(t, "plugin-auth", auth.Verifier.cfg.Issuer)
+	assert.Same(t, auth.client(), auth.Verifier.cfg.HTTPClient)
+
+	require.NotNil(t, auth.DecisionCache)
+	assert.Equal(t, 10, auth.DecisionCache.cfg.MaxEntries)
+}
+
+func TestNewAuthClient_WrapsOptions(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+
+	var logger log.Logger = &testLogger{}
+
+	auth := NewAuthClient(server.URL, true, &logger)
+
+	assert.True(t, auth.Enabled)
+	assert.Same(t, logger, auth.Logger)
+	assert.Equal(t, int32(1), server.healthChecks.Load())
+
+	disabled := NewAuthClient(server.URL, false, &logger)
+
+	assert.False(t, disabled.Enabled)
+	assert.Equal(t, int32(1), server.healthChecks.Load())
+}
@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/LerianStudio/lib-observability/tracing"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ErrNoPolicy is returned by a PolicyResolver that has no Policy for a call, so that
+// MethodPolicies and DefaultPolicy apply.
+var ErrNoPolicy = errors.New("no policy for request")
+
+// PolicyResolver resolves the Policy of a call from its request message, e.g. to authorize a
+// generic Execute(command) RPC per command type. req is nil for streams.
+type PolicyResolver func(ctx context.Context, fullMethod string, req any) (Policy, error)
+
+// resolvePolicy returns the Policy of the call fullMethod: from cfg.PolicyResolver unless it returns
+// ErrNoPolicy, and otherwise from MethodPolicies and DefaultPolicy. Errors are gRPC status errors:
+// those of the resolver are returned as is, and any other failure, including a resolved policy
+// missing its resource or action, is Internal.
+func (cfg PolicyConfig) resolvePolicy(ctx context.Context, span trace.Span, fullMethod string, req any) (Policy, error) {
+	if cfg.PolicyResolver != nil {
+		pol, err := cfg.PolicyResolver(ctx, fullMethod, req)
+
+		switch {
+		case errors.Is(err, ErrNoPolicy):
+		case err != nil:
+			tracing.HandleSpanError(span, "failed to resolve policy", err)
+
+			if _, ok := status.FromError(err); ok {
+				return Policy{}, err
+			}
+
+			return Policy{}, status.Error(codes.Internal, "internal configuration error")
+		case (pol.Resource == "") != (pol.Action == ""), pol.Resource == "" && !pol.localOnly():
+			tracing.HandleSpanError(span, "resolved an incomplete policy", fmt.Errorf("%s", fullMethod))
+
+			return Policy{}, status.Error(codes.Internal, "internal configuration error")
+		default:
+			return pol, nil
+		}
+	}
+
+	pol, found := policyForMethod(cfg, fullMethod)
+	if !found {
+		tracing.HandleSpanError(span, "no policy configured for method", fmt.Errorf("%s", fullMethod))
+
+		return Policy{}, status.Error(codes.Internal, "internal configuration error")
+	}
+
+	return pol, nil
+}
+
+// MessagePolicy configures PolicyFromMessage. The resource and action of a call are each taken from
+// the first source that has them: the field options, the message fields, then Base.
+type MessagePolicy struct {
+	// ResourceOption and ActionOption are string extensions of google.protobuf.FieldOptions, e.g.
+	// the generated E_Resource and E_Action of an "auth.resource" and "auth.action" option. They
+	// are read from the set field carrying ResourceOption, searching nested messages, such as the
+	// set member of a command oneof. Requests setting more than one such field are rejected with
+	// InvalidArgument, since the client would choose which one is checked.
+	ResourceOption protoreflect.ExtensionType
+	ActionOption   protoreflect.ExtensionType
+
+	// ResourceField and ActionField are dot-separated paths of the fields holding the resource and
+	// action, e.g. "command.resource"; JSON names are accepted too. The client sets these fields,
+	// and so chooses the permission checked: for security-relevant RPCs, prefer ResourceOption and
+	// ActionOption, which the schema defines.
+	ResourceField string
+	ActionField   string
+
+	// Base provides the other settings of the resolved Policy (Scopes, Condition, ...) and the
+	// default resource and action.
+	Base Policy
+
+	// Fallback lets requests without a resource or action fall back to MethodPolicies and
+	// DefaultPolicy. They are rejected otherwise, as those may grant more than the message would.
+	Fallback bool
+}
+
+// PolicyFromMessage returns a PolicyResolver reading the resource and action from the request
+// message through protobuf reflection, as configured by cfg. It returns ErrNoPolicy for streams and
+// other non-protobuf requests. When either is neither found nor defaulted by cfg.Base, it fails with
+// InvalidArgument, or returns ErrNoPolicy if cfg.Fallback is set.
+func PolicyFromMessage(cfg MessagePolicy) PolicyResolver {
+	return func(_ context.Context, _ string, req any) (Policy, error) {
+		pol := cfg.Base
+
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return Policy{}, ErrNoPolicy
+		}
+
+		var resource, action string
+
+		if cfg.ResourceOption != nil {
+			var matches int
+
+			resource, action, matches = fieldOptions(msg.ProtoReflect(), cfg.ResourceOption, cfg.ActionOption)
+			if matches > 1 {
+				return Policy{}, status.Error(codes.InvalidArgument, "request sets more than one field identifying a resource")
+			}
+		}
+
+		if resource == "" && cfg.ResourceField != "" {
+			resource, _ = messageField(req, cfg.ResourceField)
+		}
+
+		if action == "" && cfg.ActionField != "" {
+			action, _ = messageField(req, cfg.ActionField)
+		}
+
+		if resource != "" {
+			pol.Resource = resource
+		}
+
+		if action != "" {
+			pol.Action = action
+		}
+
+		if pol.Resource == "" || pol.Action == "" {
+			if cfg.Fallback {
+				return Policy{}, ErrNoPolicy
+			}
+
+			return Policy{}, status.Error(codes.InvalidArgument, "request does not identify a resource and action")
+		}
+
+		return pol, nil
+	}
+}
+
+// fieldOptions returns the resourceOpt and actionOpt values of the first set field of m carrying
+// resourceOpt, in field order and depth first, and the number of set fields carrying it. Fields
+// carrying resourceOpt are not searched.
+func fieldOptions(m protoreflect.Message, resourceOpt, actionOpt protoreflect.ExtensionType) (resource, action string, matches int) {
+	fields := m.Descriptor().Fields()
+
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		if !m.Has(fd) {
+			continue
+		}
+
+		if opts := fd.Options(); opts != nil && proto.HasExtension(opts, resourceOpt) {
+			if matches++; matches == 1 {
+				resource, _ = proto.GetExtension(opts, resourceOpt).(string)
+
+				if actionOpt != nil && proto.HasExtension(opts, actionOpt) {
+					action, _ = proto.GetExtension(opts, actionOpt).(string)
+				}
+			}
+
+			continue
+		}
+
+		if fd.Message() != nil && !fd.IsList() && !fd.IsMap() {
+			nestedResource, nestedAction, nested := fieldOptions(m.Get(fd).Message(), resourceOpt, actionOpt)
+			if matches == 0 {
+				resource, action = nestedResource, nestedAction
+			}
+
+			matches += nested
+		}
+	}
+
+	return resource, action, matches
+}
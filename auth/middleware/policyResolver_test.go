@@ -0,0 +1,335 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// commandSchema describes, without generated code:
+//
+//	extend google.protobuf.FieldOptions { string resource = 50001; string action = 50002; }
+//	message CreateLedger { string name = 1; }
+//	message DeleteAccount { string id = 1; }
+//	message Command {
+//	  oneof command {
+//	    CreateLedger create_ledger = 1 [(resource) = "ledgers", (action) = "post"];
+//	    DeleteAccount delete_account = 2 [(resource) = "accounts", (action) = "delete"];
+//	  }
+//	  string resource = 3;
+//	  string action = 4;
+//	}
+//	message Execute { Command command = 1; }
+//	message Plan {
+//	  CreateLedger create_ledger = 1 [(resource) = "ledgers", (action) = "post"];
+//	  DeleteAccount delete_account = 2 [(resource) = "accounts", (action) = "delete"];
+//	}
+type commandSchema struct {
+	resourceOpt, actionOpt protoreflect.ExtensionType
+	execute, command, plan protoreflect.MessageDescriptor
+	createLedger           protoreflect.MessageDescriptor
+	deleteAccount          protoreflect.MessageDescriptor
+}
+
+func newCommandSchema(t *testing.T) commandSchema {
+	t.Helper()
+
+	files := new(protoregistry.Files)
+	require.NoError(t, files.RegisterFile(descriptorpb.File_google_protobuf_descriptor_proto))
+
+	optionsFile, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("authtest/options.proto"),
+		Package:    proto.String("authtest"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/descriptor.proto"},
+		Extension: []*descriptorpb.FieldDescriptorProto{
+			{Name: proto.String("resource"), Number: proto.Int32(50001), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Extendee: proto.String(".google.protobuf.FieldOptions")},
+			{Name: proto.String("action"), Number: proto.Int32(50002), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Extendee: proto.String(".google.protobuf.FieldOptions")},
+		},
+	}, files)
+	require.NoError(t, err)
+	require.NoError(t, files.RegisterFile(optionsFile))
+
+	schema := commandSchema{
+		resourceOpt: dynamicpb.NewExtensionType(optionsFile.Extensions().ByName("resource")),
+		actionOpt:   dynamicpb.NewExtensionType(optionsFile.Extensions().ByName("action")),
+	}
+
+	options := func(resource, action string) *descriptorpb.FieldOptions {
+		opts := &descriptorpb.FieldOptions{}
+		proto.SetExtension(opts, schema.resourceOpt, resource)
+		proto.SetExtension(opts, schema.actionOpt, action)
+
+		return opts
+	}
+
+	stringField := func(name string, number int32) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()}
+	}
+
+	messageField := func(name string, number int32, typeName string, opts *descriptorpb.FieldOptions, oneof *int32) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name: proto.String(name), Number: proto.Int32(number), Type: descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+			TypeName: proto.String(typeName), Options: opts, OneofIndex: oneof,
+		}
+	}
+
+	commandsFile, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("authtest/commands.proto"),
+		Package:    proto.String("authtest"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"authtest/options.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("CreateLedger"), Field: []*descriptorpb.FieldDescriptorProto{stringField("name", 1)}},
+			{Name: proto.String("DeleteAccount"), Field: []*descriptorpb.FieldDescriptorProto{stringField("id", 1)}},
+			{
+				Name: proto.String("Command"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					messageField("create_ledger", 1, ".authtest.CreateLedger", options("ledgers", "post"), proto.Int32(0)),
+					messageField("delete_account", 2, ".authtest.DeleteAccount", options("accounts", "delete"), proto.Int32(0)),
+					stringField("resource", 3),
+					stringField("action", 4),
+				},
+				OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("command")}},
+			},
+			{Name: proto.String("Execute"), Field: []*descriptorpb.FieldDescriptorProto{messageField("command", 1, ".authtest.Command", nil, nil)}},
+			{
+				Name: proto.String("Plan"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					messageField("create_ledger", 1, ".authtest.CreateLedger", options("ledgers", "post"), nil),
+					messageField("delete_account", 2, ".authtest.DeleteAccount", options("accounts", "delete"), nil),
+				},
+			},
+		},
+	}, files)
+	require.NoError(t, err)
+
+	messages := commandsFile.Messages()
+	schema.createLedger = messages.ByName("CreateLedger")
+	schema.deleteAccount = messages.ByName("DeleteAccount")
+	schema.command = messages.ByName("Command")
+	schema.execute = messages.ByName("Execute")
+	schema.plan = messages.ByName("Plan")
+
+	return schema
+}
+
+// newExecute builds an Execute request whose command sets member (empty for none) and the given
+// resource and action fields.
+func (s commandSchema) newExecute(member, resource, action string) proto.Message {
+	command := dynamicpb.NewMessage(s.command)
+
+	switch member {
+	case "create_ledger":
+		command.Set(s.command.Fields().ByName("create_ledger"), protoreflect.ValueOfMessage(dynamicpb.NewMessage(s.createLedger)))
+	case "delete_account":
+		command.Set(s.command.Fields().ByName("delete_account"), protoreflect.ValueOfMessage(dynamicpb.NewMessage(s.deleteAccount)))
+	}
+
+	command.Set(s.command.Fields().ByName("resource"), protoreflect.ValueOfString(resource))
+	command.Set(s.command.Fields().ByName("action"), protoreflect.ValueOfString(action))
+
+	execute := dynamicpb.NewMessage(s.execute)
+	execute.Set(s.execute.Fields().ByName("command"), protoreflect.ValueOfMessage(command))
+
+	return execute
+}
+
+// newPlan builds a Plan request setting the given members, which are not in a oneof.
+func (s commandSchema) newPlan(members ...string) proto.Message {
+	plan := dynamicpb.NewMessage(s.plan)
+
+	for _, member := range members {
+		fd := s.plan.Fields().ByName(protoreflect.Name(member))
+		plan.Set(fd, protoreflect.ValueOfMessage(dynamicpb.NewMessage(fd.Message())))
+	}
+
+	return plan
+}
+
+// ---------------------------------------------------------------------------
+// PolicyFromMessage
+// ---------------------------------------------------------------------------
+
+func TestPolicyFromMessage(t *testing.T) {
+	t.Parallel()
+
+	schema := newCommandSchema(t)
+
+	fromOptions := MessagePolicy{
+		ResourceOption: schema.resourceOpt,
+		ActionOption:   schema.actionOpt,
+		ResourceField:  "command.resource",
+		ActionField:    "command.action",
+		Base:           Policy{Scopes: []string{"commands:execute"}},
+	}
+
+	fromFields := MessagePolicy{ResourceField: "command.resource", ActionField: "command.action"}
+
+	withDefaults := MessagePolicy{ResourceOption: schema.resourceOpt, Base: Policy{Resource: "commands", Action: "execute"}}
+
+	withFallback := MessagePolicy{ResourceOption: schema.resourceOpt, ActionOption: schema.actionOpt, Fallback: true}
+
+	tests := []struct {
+		name     string
+		cfg      MessagePolicy
+		req      any
+		want     Policy
+		wantErr  error
+		wantCode codes.Code
+	}{
+		{
+			name: "oneof_member_option",
+			cfg:  fromOptions,
+			req:  schema.newExecute("create_ledger", "ignored", "ignored"),
+			want: Policy{Resource: "ledgers", Action: "post", Scopes: []string{"commands:execute"}},
+		},
+		{
+			name: "other_oneof_member",
+			cfg:  fromOptions,
+			req:  schema.newExecute("delete_account", "", ""),
+			want: Policy{Resource: "accounts", Action: "delete", Scopes: []string{"commands:execute"}},
+		},
+		{
+			name: "fields_when_no_option",
+			cfg:  fromOptions,
+			req:  schema.newExecute("", "balances", "patch"),
+			want: Policy{Resource: "balances", Action: "patch", Scopes: []string{"commands:execute"}},
+		},
+		{name: "fields_only", cfg: fromFields, req: schema.newExecute("delete_account", "ledgers", "get"), want: Policy{Resource: "ledgers", Action: "get"}},
+		{name: "base_defaults", cfg: withDefaults, req: schema.newExecute("", "", ""), want: Policy{Resource: "commands", Action: "execute"}},
+		{name: "option_with_base_action", cfg: withDefaults, req: schema.newExecute("create_ledger", "", ""), want: Policy{Resource: "ledgers", Action: "execute"}},
+		{name: "nothing_found", cfg: fromFields, req: schema.newExecute("", "", ""), wantCode: codes.InvalidArgument},
+		{name: "action_missing", cfg: fromFields, req: schema.newExecute("", "ledgers", ""), wantCode: codes.InvalidArgument},
+		{name: "fallback", cfg: withFallback, req: schema.newExecute("", "", ""), wantErr: ErrNoPolicy},
+		{name: "single_option_field", cfg: fromOptions, req: schema.newPlan("delete_account"), want: Policy{Resource: "accounts", Action: "delete", Scopes: []string{"commands:execute"}}},
+		{name: "several_option_fields", cfg: fromOptions, req: schema.newPlan("create_ledger", "delete_account"), wantCode: codes.InvalidArgument},
+		{name: "several_option_fields_with_fallback", cfg: withFallback, req: schema.newPlan("create_ledger", "delete_account"), wantCode: codes.InvalidArgument},
+		{name: "stream", cfg: fromOptions, wantErr: ErrNoPolicy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pol, err := PolicyFromMessage(tt.cfg)(context.Background(), "/pkg.Commands/Execute", tt.req)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+
+			if tt.wantCode != codes.OK {
+				assert.Equal(t, tt.wantCode, status.Code(err))
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, pol)
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// PolicyConfig.PolicyResolver
+// ---------------------------------------------------------------------------
+
+func TestGRPCPolicy_PolicyResolver(t *testing.T) {
+	t.Parallel()
+
+	schema := newCommandSchema(t)
+
+	fromOptions := PolicyFromMessage(MessagePolicy{ResourceOption: schema.resourceOpt, ActionOption: schema.actionOpt})
+	withFallback := PolicyFromMessage(MessagePolicy{ResourceOption: schema.resourceOpt, ActionOption: schema.actionOpt, Fallback: true})
+
+	tests := []struct {
+		name         string
+		resolver     PolicyResolver
+		req          any
+		wantCode     codes.Code
+		wantResource string
+	}{
+		{name: "resolved", resolver: fromOptions, req: schema.newExecute("delete_account", "", ""), wantCode: codes.OK, wantResource: "accounts"},
+		{name: "empty_oneof_does_not_fall_back", resolver: fromOptions, req: schema.newExecute("", "", ""), wantCode: codes.InvalidArgument},
+		{name: "falls_back_to_default", resolver: withFallback, req: schema.newExecute("", "", ""), wantCode: codes.OK, wantResource: "commands"},
+		{
+			name: "status_error_as_is",
+			resolver: func(context.Context, string, any) (Policy, error) {
+				return Policy{}, status.Error(codes.InvalidArgument, "unknown command")
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "other_error",
+			resolver: func(context.Context, string, any) (Policy, error) { return Policy{}, errors.New("boom") },
+			wantCode: codes.Internal,
+		},
+		{
+			name:     "empty_policy",
+			resolver: func(context.Context, string, any) (Policy, error) { return Policy{}, nil },
+			wantCode: codes.Internal,
+		},
+		{
+			name:     "policy_without_action",
+			resolver: func(context.Context, string, any) (Policy, error) { return Policy{Resource: "ledgers"}, nil },
+			wantCode: codes.Internal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newAuthServer(t)
+
+			auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+			cfg := PolicyConfig{PolicyResolver: tt.resolver, DefaultPolicy: &Policy{Resource: "commands", Action: "execute"}}
+
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+createTestJWT(userClaims())))
+
+			_, err := NewGRPCAuthUnaryPolicy(auth, cfg)(ctx, tt.req, &grpc.UnaryServerInfo{FullMethod: "/pkg.Commands/Execute"}, func(context.Context, any) (any, error) {
+				return "ok", nil
+			})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+
+			if tt.wantResource != "" {
+				assert.Equal(t, []string{tt.wantResource}, server.recorded())
+			} else {
+				assert.Empty(t, server.recorded())
+			}
+		})
+	}
+}
+
+func TestGRPCStreamPolicy_PolicyResolver(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+	cfg := PolicyConfig{
+		PolicyResolver: PolicyFromMessage(MessagePolicy{ResourceField: "resource"}),
+		MethodPolicies: map[string]Policy{"/pkg.Commands/Watch": {Resource: "commands", Action: "watch"}},
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+createTestJWT(userClaims())))
+
+	err := NewGRPCAuthStreamPolicy(auth, cfg)(nil, &fakeServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/pkg.Commands/Watch"},
+		func(any, grpc.ServerStream) error { return nil })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"commands"}, server.recorded())
+}
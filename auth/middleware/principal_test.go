@@ -0,0 +1,232 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ---------------------------------------------------------------------------
+// newPrincipal
+// ---------------------------------------------------------------------------
+
+func TestNewPrincipal(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		subject string
+		want    Principal
+	}{
+		{
+			name: "normal_user",
+			claims: jwt.MapClaims{
+				"type": "normal-user", "owner": "acme", "sub": "user1",
+				"tenantId": "t-1", "tenantSlug": "acme-prod", "scope": "ledgers:read  ledgers:write",
+			},
+			subject: "acme/user1",
+			want: Principal{
+				Subject: "acme/user1", Owner: "acme", UserID: "user1", UserType: "normal-user",
+				TenantID: "t-1", TenantSlug: "acme-prod", Scopes: []string{"ledgers:read", "ledgers:write"},
+			},
+		},
+		{
+			name:    "application_with_scope_list",
+			claims:  jwt.MapClaims{"type": "application", "sub": "app1", "scp": []any{"ledgers:read", 42, ""}},
+			subject: "admin/midaz-editor-role",
+			want: Principal{
+				Subject: "admin/midaz-editor-role", UserID: "app1", UserType: "application", Scopes: []string{"ledgers:read"},
+			},
+		},
+		{
+			name:    "without_scopes",
+			claims:  jwt.MapClaims{"sub": "app1", "scope": " "},
+			subject: "admin/midaz-editor-role",
+			want:    Principal{Subject: "admin/midaz-editor-role", UserID: "app1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := newPrincipal(tt.claims, tt.subject)
+
+			tt.want.Claims = tt.claims
+			assert.Equal(t, &tt.want, got)
+		})
+	}
+}
+
+func TestPrincipal_Helpers(t *testing.T) {
+	t.Parallel()
+
+	p := &Principal{UserType: normalUser, Scopes: []string{"ledgers:read"}}
+
+	assert.True(t, p.IsNormalUser())
+	assert.True(t, p.HasScope("ledgers:read"))
+	assert.False(t, p.HasScope("ledgers:write"))
+	assert.False(t, (&Principal{UserType: "application"}).IsNormalUser())
+}
+
+// ---------------------------------------------------------------------------
+// PrincipalFromContext
+// ---------------------------------------------------------------------------
+
+func TestPrincipalFromContext(t *testing.T) {
+	t.Parallel()
+
+	_, ok := PrincipalFromContext(context.Background())
+	assert.False(t, ok)
+
+	_, ok = PrincipalFromContext(ContextWithPrincipal(context.Background(), nil))
+	assert.False(t, ok)
+
+	want := &Principal{Subject: "acme/user1"}
+
+	got, ok := PrincipalFromContext(ContextWithPrincipal(context.Background(), want))
+	require.True(t, ok)
+	assert.Same(t, want, got)
+}
+
+// ---------------------------------------------------------------------------
+// Authorize
+// ---------------------------------------------------------------------------
+
+func TestAuthorize_SetsPrincipal(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		authorized    bool
+		wantStatus    int
+		wantPrincipal bool
+	}{
+		{name: "authorized", authorized: true, wantStatus: http.StatusOK, wantPrincipal: true},
+		{name: "forbidden", authorized: false, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := mockAuthServer(t, tt.authorized, http.StatusOK)
+			t.Cleanup(server.Close)
+
+			auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+
+			var (
+				fromFiber, fromContext *Principal
+				called                 bool
+			)
+
+			app := fiber.New()
+			app.Get("/ledgers", auth.Authorize("midaz", "ledgers", "get"), func(c *fiber.Ctx) error {
+				called = true
+				fromFiber, _ = PrincipalFromFiber(c)
+				fromContext, _ = PrincipalFromContext(c.UserContext())
+
+				return c.SendStatus(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/ledgers", nil)
+			req.Header.Set("Authorization", "Bearer "+createTestJWT(jwt.MapClaims{"type": "normal-user", "owner": "acme", "sub": "user1", "tenantId": "t-1"}))
+
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantPrincipal, called)
+
+			if !tt.wantPrincipal {
+				return
+			}
+
+			require.NotNil(t, fromFiber)
+			assert.Same(t, fromFiber, fromContext)
+			assert.Equal(t, "acme/user1", fromFiber.Subject)
+			assert.Equal(t, "user1", fromFiber.UserID)
+			assert.Equal(t, "t-1", fromFiber.TenantID)
+		})
+	}
+}
+
+func TestAuthorize_DisabledClientHasNoPrincipal(t *testing.T) {
+	t.Parallel()
+
+	auth := NewAuthClientWithOptions("http://plugin-auth:4000", WithEnabled(false), WithLogger(&testLogger{}))
+
+	var ok bool
+
+	app := fiber.New()
+	app.Get("/ledgers", auth.Authorize("midaz", "ledgers", "get"), func(c *fiber.Ctx) error {
+		_, ok = PrincipalFromFiber(c)
+
+		return c.SendStatus(http.StatusOK)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/ledgers", nil))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.False(t, ok)
+}
+
+// ---------------------------------------------------------------------------
+// gRPC interceptors
+// ---------------------------------------------------------------------------
+
+func TestGRPCPolicies_SetPrincipal(t *testing.T) {
+	t.Parallel()
+
+	server := mockAuthServer(t, true, http.StatusOK)
+	t.Cleanup(server.Close)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+	cfg := PolicyConfig{DefaultPolicy: &Policy{Resource: "ledgers", Action: "get"}, SubResolver: SubFromMetadata("md-product")}
+
+	token := createTestJWT(jwt.MapClaims{"type": "application", "sub": "app1", "scope": "ledgers:read"})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token, "md-product", "midaz"))
+
+	t.Run("unary", func(t *testing.T) {
+		t.Parallel()
+
+		var principal *Principal
+
+		_, err := NewGRPCAuthUnaryPolicy(auth, cfg)(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Get"}, func(ctx context.Context, _ any) (any, error) {
+			principal, _ = PrincipalFromContext(ctx)
+
+			return "ok", nil
+		})
+		require.NoError(t, err)
+		require.NotNil(t, principal)
+		assert.Equal(t, "admin/midaz-editor-role", principal.Subject)
+		assert.Equal(t, []string{"ledgers:read"}, principal.Scopes)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		t.Parallel()
+
+		var principal *Principal
+
+		err := NewGRPCAuthStreamPolicy(auth, cfg)(nil, &fakeServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/pkg.Service/Stream"}, func(_ any, ss grpc.ServerStream) error {
+			principal, _ = PrincipalFromContext(ss.Context())
+
+			return nil
+		})
+		require.NoError(t, err)
+		require.NotNil(t, principal)
+		assert.Equal(t, "app1", principal.UserID)
+	})
+}
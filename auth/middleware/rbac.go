@@ -0,0 +1,280 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// rbacWildcard matches any resource or action in an RBACRole grant.
+const rbacWildcard = "*"
+
+// ErrInvalidRBACModel is returned when an RBAC model cannot be loaded or is inconsistent.
+var ErrInvalidRBACModel = errors.New("invalid RBAC model")
+
+// RBACModel is a local role-based access control model, typically loaded from a YAML or JSON file
+// with LoadRBACModel:
+//
+//	roles:
+//	  - name: viewer
+//	    grants:
+//	      - {resource: ledgers, action: get}
+//	  - name: editor
+//	    inherits: [viewer]
+//	    grants:
+//	      - {resource: ledgers, action: "*"}
+//	bindings:
+//	  - subject: admin/midaz-editor-role
+//	    roles: [editor]
+//	  - subject: acme/user1
+//	    product: midaz
+//	    roles: [viewer]
+type RBACModel struct {
+	Roles    []RBACRole    `json:"roles" yaml:"roles"`
+	Bindings []RBACBinding `json:"bindings" yaml:"bindings"`
+}
+
+// RBACRole grants permissions, plus those of the roles it inherits. A Resource or Action of "*"
+// matches any value, and a "*" segment of a Resource any single segment of a resource instance,
+// e.g. "ledgers/*/accounts/*" matches "ledgers/123/accounts/456".
+type RBACRole struct {
+	Name     string       `json:"name" yaml:"name"`
+	Inherits []string     `json:"inherits,omitempty" yaml:"inherits,omitempty"`
+	Grants   []Permission `json:"grants,omitempty" yaml:"grants,omitempty"`
+}
+
+// RBACBinding assigns roles to an authorization subject as derived from the token: "<owner>/<userID>"
+// for normal users and "admin/<product>-editor-role" for applications. When Product is set, the
+// roles only apply to requests for that product.
+type RBACBinding struct {
+	Subject string   `json:"subject" yaml:"subject"`
+	Product string   `json:"product,omitempty" yaml:"product,omitempty"`
+	Roles   []string `json:"roles" yaml:"roles"`
+}
+
+// LoadRBACModel reads an RBACModel from path, as JSON when it has a .json extension and as YAML
+// otherwise. Unknown fields are rejected so that typos do not silently drop grants.
+func LoadRBACModel(path string) (RBACModel, error) {
+	var model RBACModel
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return model, fmt.Errorf("%w: %w", ErrInvalidRBACModel, err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+
+		err = dec.Decode(&model)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+
+		err = dec.Decode(&model)
+	}
+
+	if err != nil {
+		return RBACModel{}, fmt.Errorf("%w: %s: %w", ErrInvalidRBACModel, path, err)
+	}
+
+	return model, nil
+}
+
+// RBACAuthorizer is an Authorizer deciding requests offline from an RBACModel, for deployments
+// and tests without the auth service. It trusts the subject derived from the token, so the
+// AuthClient must verify tokens against the keys of their issuer, e.g. a JWKS file:
+//
+//	model, err := middleware.LoadRBACModel("rbac.yaml")
+//	...
+//	rbac, err := middleware.NewRBACAuthorizer(model)
+//	...
+//	jwks, err := os.ReadFile("jwks.json")
+//	...
+//	auth := middleware.NewAuthClientWithOptions("",
+//		middleware.WithAuthorizer(rbac),
+//		middleware.WithJWKS(middleware.JWKSConfig{JSON: jwks}),
+//	)
+type RBACAuthorizer struct {
+	bindings map[string][]rbacGrants
+}
+
+// rbacGrants are the permissions a binding grants, restricted to product when not empty.
+// patterns are the permissions whose resource has "*" segments.
+type rbacGrants struct {
+	product     string
+	permissions map[Permission]struct{}
+	patterns    []Permission
+}
+
+// NewRBACAuthorizer validates model and resolves the permissions of every binding. It fails with
+// ErrInvalidRBACModel on unnamed or duplicate roles, references to unknown roles and inheritance
+// cycles.
+func NewRBACAuthorizer(model RBACModel) (*RBACAuthorizer, error) {
+	roles := make(map[string]RBACRole, len(model.Roles))
+
+	for _, role := range model.Roles {
+		if role.Name == "" {
+			return nil, fmt.Errorf("%w: role without name", ErrInvalidRBACModel)
+		}
+
+		if _, dup := roles[role.Name]; dup {
+			return nil, fmt.Errorf("%w: duplicate role %q", ErrInvalidRBACModel, role.Name)
+		}
+
+		roles[role.Name] = role
+	}
+
+	resolved := make(map[string]map[Permission]struct{}, len(roles))
+
+	for name := range roles {
+		if _, err := resolveRole(roles, resolved, name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	rbac := &RBACAuthorizer{bindings: make(map[string][]rbacGrants, len(model.Bindings))}
+
+	for _, binding := range model.Bindings {
+		if binding.Subject == "" {
+			return nil, fmt.Errorf("%w: binding without subject", ErrInvalidRBACModel)
+		}
+
+		grants := rbacGrants{product: binding.Product, permissions: map[Permission]struct{}{}}
+
+		for _, name := range binding.Roles {
+			permissions, ok := resolved[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: subject %q is bound to unknown role %q", ErrInvalidRBACModel, binding.Subject, name)
+			}
+
+			for perm := range permissions {
+				grants.permissions[perm] = struct{}{}
+			}
+		}
+
+		for perm := range grants.permissions {
+			if perm.Resource != rbacWildcard && slices.Contains(strings.Split(perm.Resource, "/"), rbacWildcard) {
+				grants.patterns = append(grants.patterns, perm)
+			}
+		}
+
+		rbac.bindings[binding.Subject] = append(rbac.bindings[binding.Subject], grants)
+	}
+
+	return rbac, nil
+}
+
+// resolveRole returns the permissions of name and the roles it inherits, memoized in resolved.
+// path holds the roles being resolved, to detect inheritance cycles.
+func resolveRole(roles map[string]RBACRole, resolved map[string]map[Permission]struct{}, name string, path []string) (map[Permission]struct{}, error) {
+	if permissions, ok := resolved[name]; ok {
+		return permissions, nil
+	}
+
+	role, ok := roles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: role %q inherits unknown role %q", ErrInvalidRBACModel, path[len(path)-1], name)
+	}
+
+	for _, seen := range path {
+		if seen == name {
+			return nil, fmt.Errorf("%w: inheritance cycle %s", ErrInvalidRBACModel, strings.Join(append(path, name), " -> "))
+		}
+	}
+
+	permissions := make(map[Permission]struct{}, len(role.Grants))
+
+	for _, grant := range role.Grants {
+		if grant.Resource == "" || grant.Action == "" {
+			return nil, fmt.Errorf("%w: role %q has a grant without resource or action", ErrInvalidRBACModel, name)
+		}
+
+		permissions[grant] = struct{}{}
+	}
+
+	for _, parent := range role.Inherits {
+		inherited, err := resolveRole(roles, resolved, parent, append(path, name))
+		if err != nil {
+			return nil, err
+		}
+
+		for perm := range inherited {
+			permissions[perm] = struct{}{}
+		}
+	}
+
+	resolved[name] = permissions
+
+	return permissions, nil
+}
+
+// Check authorizes req when a binding of its subject, for any product or for req.Product, grants
+// the resource and action.
+func (r *RBACAuthorizer) Check(_ context.Context, req Request) (Decision, error) {
+	decision := Decision{StatusCode: http.StatusOK}
+
+	if req.Principal == nil {
+		return decision, nil
+	}
+
+	for _, grants := range r.bindings[req.Principal.Subject] {
+		if grants.product != "" && grants.product != req.Product {
+			continue
+		}
+
+		if grants.allow(req.Resource, req.Action) {
+			decision.Authorized = true
+
+			return decision, nil
+		}
+	}
+
+	return decision, nil
+}
+
+func (g rbacGrants) allow(resource, action string) bool {
+	for _, perm := range []Permission{
+		{Resource: resource, Action: action},
+		{Resource: resource, Action: rbacWildcard},
+		{Resource: rbacWildcard, Action: action},
+		{Resource: rbacWildcard, Action: rbacWildcard},
+	} {
+		if _, ok := g.permissions[perm]; ok {
+			return true
+		}
+	}
+
+	for _, pattern := range g.patterns {
+		if (pattern.Action == action || pattern.Action == rbacWildcard) && matchResource(pattern.Resource, resource) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchResource reports whether resource matches pattern segment by segment, "*" matching any one.
+func matchResource(pattern, resource string) bool {
+	want, got := strings.Split(pattern, "/"), strings.Split(resource, "/")
+	if len(want) != len(got) {
+		return false
+	}
+
+	for i := range want {
+		if want[i] != rbacWildcard && want[i] != got[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,343 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const rbacYAML = `
+roles:
+  - name: viewer
+    grants:
+      - {resource: ledgers, action: get}
+      - {resource: accounts, action: get}
+  - name: editor
+    inherits: [viewer]
+    grants:
+      - {resource: ledgers, action: "*"}
+  - name: auditor
+    grants:
+      - {resource: "*", action: get}
+bindings:
+  - subject: admin/midaz-editor-role
+    roles: [editor]
+  - subject: acme/user1
+    product: midaz
+    roles: [viewer]
+  - subject: acme/user1
+    product: reporter
+    roles: [auditor]
+`
+
+const rbacJSON = `{
+  "roles": [
+    {"name": "viewer", "grants": [{"resource": "ledgers", "action": "get"}, {"resource": "accounts", "action": "get"}]},
+    {"name": "editor", "inherits": ["viewer"], "grants": [{"resource": "ledgers", "action": "*"}]},
+    {"name": "auditor", "grants": [{"resource": "*", "action": "get"}]}
+  ],
+  "bindings": [
+    {"subject": "admin/midaz-editor-role", "roles": ["editor"]},
+    {"subject": "acme/user1", "product": "midaz", "roles": ["viewer"]},
+    {"subject": "acme/user1", "product": "reporter", "roles": ["auditor"]}
+  ]
+}`
+
+func writeRBACFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func newTestRBAC(t *testing.T) *RBACAuthorizer {
+	t.Helper()
+
+	model, err := LoadRBACModel(writeRBACFile(t, "rbac.yaml", rbacYAML))
+	require.NoError(t, err)
+
+	rbac, err := NewRBACAuthorizer(model)
+	require.NoError(t, err)
+
+	return rbac
+}
+
+// ---------------------------------------------------------------------------
+// LoadRBACModel
+// ---------------------------------------------------------------------------
+
+func TestLoadRBACModel(t *testing.T) {
+	t.Parallel()
+
+	fromYAML, err := LoadRBACModel(writeRBACFile(t, "rbac.yaml", rbacYAML))
+	require.NoError(t, err)
+
+	fromJSON, err := LoadRBACModel(writeRBACFile(t, "rbac.json", rbacJSON))
+	require.NoError(t, err)
+
+	assert.Equal(t, fromYAML, fromJSON)
+	assert.Len(t, fromYAML.Roles, 3)
+	assert.Equal(t, RBACBinding{Subject: "acme/user1", Product: "midaz", Roles: []string{"viewer"}}, fromYAML.Bindings[1])
+}
+
+func TestLoadRBACModel_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		path func(t *testing.T) string
+	}{
+		{name: "missing_file", path: func(t *testing.T) string { return filepath.Join(t.TempDir(), "rbac.yaml") }},
+		{name: "unknown_yaml_field", path: func(t *testing.T) string {
+			return writeRBACFile(t, "rbac.yml", "roles:\n  - name: viewer\n    grant: []\n")
+		}},
+		{name: "unknown_json_field", path: func(t *testing.T) string {
+			return writeRBACFile(t, "rbac.json", `{"roles": [{"name": "viewer", "grant": []}]}`)
+		}},
+		{name: "malformed", path: func(t *testing.T) string { return writeRBACFile(t, "rbac.json", `{"roles": [`) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := LoadRBACModel(tt.path(t))
+			require.ErrorIs(t, err, ErrInvalidRBACModel)
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// NewRBACAuthorizer
+// ---------------------------------------------------------------------------
+
+func TestNewRBACAuthorizer_InvalidModel(t *testing.T) {
+	t.Parallel()
+
+	viewer := RBACRole{Name: "viewer", Grants: []Permission{{Resource: "ledgers", Action: "get"}}}
+
+	tests := []struct {
+		name    string
+		model   RBACModel
+		wantErr string
+	}{
+		{name: "unnamed_role", model: RBACModel{Roles: []RBACRole{{}}}, wantErr: "role without name"},
+		{name: "duplicate_role", model: RBACModel{Roles: []RBACRole{viewer, viewer}}, wantErr: `duplicate role "viewer"`},
+		{name: "empty_grant", model: RBACModel{Roles: []RBACRole{{Name: "viewer", Grants: []Permission{{Resource: "ledgers"}}}}}, wantErr: "grant without resource or action"},
+		{
+			name:    "unknown_parent",
+			model:   RBACModel{Roles: []RBACRole{{Name: "editor", Inherits: []string{"viewer"}}}},
+			wantErr: `role "editor" inherits unknown role "viewer"`,
+		},
+		{
+			name: "cycle",
+			model: RBACModel{Roles: []RBACRole{
+				{Name: "a", Inherits: []string{"b"}},
+				{Name: "b", Inherits: []string{"c"}},
+				{Name: "c", Inherits: []string{"a"}},
+			}},
+			wantErr: "inheritance cycle",
+		},
+		{
+			name:    "unknown_bound_role",
+			model:   RBACModel{Roles: []RBACRole{viewer}, Bindings: []RBACBinding{{Subject: "acme/user1", Roles: []string{"editor"}}}},
+			wantErr: `subject "acme/user1" is bound to unknown role "editor"`,
+		},
+		{name: "binding_without_subject", model: RBACModel{Roles: []RBACRole{viewer}, Bindings: []RBACBinding{{Roles: []string{"viewer"}}}}, wantErr: "binding without subject"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewRBACAuthorizer(tt.model)
+			require.ErrorIs(t, err, ErrInvalidRBACModel)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// RBACAuthorizer.Check
+// ---------------------------------------------------------------------------
+
+func TestRBACAuthorizer_Check(t *testing.T) {
+	t.Parallel()
+
+	rbac := newTestRBAC(t)
+
+	tests := []struct {
+		name     string
+		subject  string
+		product  string
+		resource string
+		action   string
+		want     bool
+	}{
+		{name: "inherited_grant", subject: "admin/midaz-editor-role", product: "midaz", resource: "accounts", action: "get", want: true},
+		{name: "wildcard_action", subject: "admin/midaz-editor-role", product: "midaz", resource: "ledgers", action: "delete", want: true},
+		{name: "not_granted", subject: "admin/midaz-editor-role", product: "midaz", resource: "accounts", action: "delete"},
+		{name: "product_binding", subject: "acme/user1", product: "midaz", resource: "ledgers", action: "get", want: true},
+		{name: "product_isolation", subject: "acme/user1", product: "midaz", resource: "reports", action: "get"},
+		{name: "other_product_binding", subject: "acme/user1", product: "reporter", resource: "reports", action: "get", want: true},
+		{name: "unbound_product", subject: "acme/user1", product: "console", resource: "ledgers", action: "get"},
+		{name: "unknown_subject", subject: "acme/user2", product: "midaz", resource: "ledgers", action: "get"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			decision, err := rbac.Check(context.Background(), Request{
+				Principal: &Principal{Subject: tt.subject},
+				Product:   tt.product,
+				Resource:  tt.resource,
+				Action:    tt.action,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, decision.Authorized)
+			assert.Equal(t, http.StatusOK, decision.StatusCode)
+		})
+	}
+
+	decision, err := rbac.Check(context.Background(), Request{Resource: "ledgers", Action: "get"})
+	require.NoError(t, err)
+	assert.False(t, decision.Authorized, "requests without principal are denied")
+}
+
+func TestRBACAuthorizer_Middleware(t *testing.T) {
+	t.Parallel()
+
+	key := newRSASigningKey(t, "edge")
+	sign := func(claims jwt.MapClaims) string {
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+
+		return key.sign(t, claims)
+	}
+
+	// Offline: the keys are static and there is no address.
+	auth := NewAuthClientWithOptions("", WithLogger(&testLogger{}), WithAuthorizer(newTestRBAC(t)), WithJWKS(JWKSConfig{JSON: staticJWKS(t, key)}))
+
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) }
+
+	app := fiber.New()
+	app.Get("/ledgers", auth.Authorize("midaz", "ledgers", "get"), ok)
+	app.Post("/ledgers", auth.Authorize("midaz", "ledgers", "post"), ok)
+
+	userToken := sign(userClaims())
+	appToken := sign(jwt.MapClaims{"type": "application", "sub": "midaz-worker"})
+
+	tests := []struct {
+		method     string
+		token      string
+		wantStatus int
+	}{
+		{method: http.MethodGet, token: userToken, wantStatus: http.StatusOK},
+		{method: http.MethodPost, token: userToken, wantStatus: http.StatusForbidden},
+		{method: http.MethodPost, token: appToken, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/ledgers", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		assert.Equal(t, tt.wantStatus, resp.StatusCode, tt.method)
+	}
+
+	cfg := PolicyConfig{
+		MethodPolicies: map[string]Policy{"/pkg.Ledgers/Create": {Resource: "ledgers", Action: "post"}},
+		SubResolver:    func(context.Context, string, any) (string, error) { return "midaz", nil },
+	}
+
+	for token, wantCode := range map[string]codes.Code{userToken: codes.PermissionDenied, appToken: codes.OK} {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+
+		_, err := NewGRPCAuthUnaryPolicy(auth, cfg)(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/pkg.Ledgers/Create"}, func(context.Context, any) (any, error) {
+			return "ok", nil
+		})
+		assert.Equal(t, wantCode, status.Code(err))
+	}
+}
+
+func TestRBACAuthorizer_ForgedToken(t *testing.T) {
+	t.Parallel()
+
+	verifier, _ := newTestVerifier(t)
+
+	verified := NewAuthClientWithOptions("", WithLogger(&testLogger{}), WithAuthorizer(newTestRBAC(t)))
+	verified.Verifier = verifier
+
+	unverified := NewAuthClientWithOptions("", WithLogger(&testLogger{}), WithAuthorizer(newTestRBAC(t)))
+
+	// Would be bound to the editor role as admin/midaz-editor-role if its claims were trusted.
+	forged := createTestJWT(jwt.MapClaims{"type": "application", "sub": "attacker"})
+
+	for auth, wantStatus := range map[*AuthClient]int{verified: http.StatusUnauthorized, unverified: http.StatusInternalServerError} {
+		app := fiber.New()
+		app.Delete("/ledgers", auth.Authorize("midaz", "ledgers", "delete"), func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
+
+		req := httptest.NewRequest(http.MethodDelete, "/ledgers", nil)
+		req.Header.Set("Authorization", "Bearer "+forged)
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		assert.Equal(t, wantStatus, resp.StatusCode)
+	}
+}
+
+func TestRBACAuthorizer_ResourcePatterns(t *testing.T) {
+	t.Parallel()
+
+	rbac, err := NewRBACAuthorizer(RBACModel{
+		Roles: []RBACRole{
+			{Name: "ledger-123", Grants: []Permission{{Resource: "ledgers/123/accounts/*", Action: "get"}}},
+			{Name: "accounts", Grants: []Permission{{Resource: "ledgers/*/accounts/*", Action: "*"}}},
+		},
+		Bindings: []RBACBinding{
+			{Subject: "acme/user1", Roles: []string{"ledger-123"}},
+			{Subject: "acme/user2", Roles: []string{"accounts"}},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		subject  string
+		resource string
+		action   string
+		want     bool
+	}{
+		{subject: "acme/user1", resource: "ledgers/123/accounts/456", action: "get", want: true},
+		{subject: "acme/user1", resource: "ledgers/124/accounts/456", action: "get"},
+		{subject: "acme/user1", resource: "ledgers/123/accounts/456", action: "delete"},
+		{subject: "acme/user1", resource: "ledgers/123/accounts", action: "get"},
+		{subject: "acme/user2", resource: "ledgers/124/accounts/456", action: "delete", want: true},
+		{subject: "acme/user2", resource: "ledgers/124/accounts/456/balances", action: "get"},
+	}
+
+	for _, tt := range tests {
+		decision, err := rbac.Check(context.Background(), Request{Principal: &Principal{Subject: tt.subject}, Resource: tt.resource, Action: tt.action})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, decision.Authorized, "%s %s %s", tt.subject, tt.action, tt.resource)
+	}
+}
@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/LerianStudio/lib-commons/v5/commons"
+	libHTTP "github.com/LerianStudio/lib-commons/v5/commons/net/http"
+	"github.com/LerianStudio/lib-observability/tracing"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrVerifierRequired is returned when the token claims would be trusted without the auth service
+// vouching for them, by local checks or a custom Authorizer, and the AuthClient has no Verifier:
+// an unverified token could be forged.
+var ErrVerifierRequired = errors.New("token verifier required")
+
+// satisfies reports whether p was granted every scope in scopes and carries every claim in
+// claims. A claim matches when its value, or one of the values of a list claim, formats as the
+// expected string; e.g. {"type": "normal-user"} or {"aud": "midaz"}.
+func (p *Principal) satisfies(scopes []string, claims map[string]string) bool {
+	for _, scope := range scopes {
+		if !p.HasScope(scope) {
+			return false
+		}
+	}
+
+	for name, want := range claims {
+		if !claimMatches(p.Claims[name], want) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func claimMatches(value any, want string) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case string:
+		return v == want
+	case []any:
+		for _, item := range v {
+			if claimMatches(item, want) {
+				return true
+			}
+		}
+
+		return false
+	default:
+		return fmt.Sprint(v) == want
+	}
+}
+
+// RequireScopes is a Fiber middleware that only lets through tokens granted every scope, without
+// calling the auth service. Place it after Authorize to compose both checks and reuse its Principal.
+// On its own it verifies the token with the AuthClient's Verifier, returning 401 for missing or
+// invalid tokens, and 500 when there is no Verifier. Requests lacking a scope get 403.
+func (auth *AuthClient) RequireScopes(scopes ...string) fiber.Handler {
+	return auth.require(scopes, nil)
+}
+
+// RequireClaims is a Fiber middleware that only lets through tokens carrying every claim with the
+// expected value, without calling the auth service; e.g. RequireClaims(map[string]string{"type": "normal-user"}).
+// It behaves like RequireScopes otherwise.
+func (auth *AuthClient) RequireClaims(claims map[string]string) fiber.Handler {
+	return auth.require(nil, claims)
+}
+
+func (auth *AuthClient) require(scopes []string, claims map[string]string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !auth.enforcing() {
+			return c.Next()
+		}
+
+		principal, ok := PrincipalFromFiber(c)
+		if !ok {
+			accessToken := libHTTP.ExtractTokenFromHeader(c)
+
+			if commons.IsNilOrEmpty(&accessToken) {
+				return c.Status(http.StatusUnauthorized).SendString("Missing Token")
+			}
+
+			var (
+				statusCode int
+				err        error
+			)
+
+			principal, statusCode, err = auth.authenticateLocally(tracing.ExtractHTTPContext(c.UserContext(), c), "", accessToken)
+			if err != nil {
+				return c.Status(statusCode).SendString(http.StatusText(statusCode))
+			}
+		}
+
+		if !principal.satisfies(scopes, claims) {
+			return c.Status(http.StatusForbidden).SendString("Forbidden")
+		}
+
+		return c.Next()
+	}
+}
+
+// authenticateLocally is authenticate within its own span, for checks that do not call /v1/authorize.
+// Without the auth service vouching for the token, it fails closed unless the token is verified.
+func (auth *AuthClient) authenticateLocally(ctx context.Context, product, accessToken string) (*Principal, int, error) {
+	tracer, reqID := auth.tracking(ctx)
+
+	ctx, span := tracer.Start(ctx, "lib_auth.authenticate")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("app.request.request_id", reqID),
+	)
+
+	if auth.Verifier == nil {
+		logErrorf(ctx, auth.Logger, "Local authorization check without a Verifier: configure WithJWKS")
+
+		tracing.HandleSpanError(span, "Local authorization check without a Verifier", ErrVerifierRequired)
+
+		return nil, http.StatusInternalServerError, ErrVerifierRequired
+	}
+
+	return auth.authenticate(ctx, span, product, accessToken)
+}
+
+// localOnly reports whether p only has local requirements, so /v1/authorize is not called.
+func (p Policy) localOnly() bool {
+	return p.Resource == "" && p.Action == "" && (len(p.Scopes) > 0 || len(p.Claims) > 0 || p.Condition != "")
+}
+
+// checkLocalPolicies logs the policies of cfg with only local requirements when auth has no
+// Verifier, as their calls are rejected with codes.Internal.
+func (cfg PolicyConfig) checkLocalPolicies(auth *AuthClient) {
+	if auth == nil || auth.Verifier != nil {
+		return
+	}
+
+	for method, pol := range cfg.MethodPolicies {
+		if pol.localOnly() {
+			logErrorf(context.Background(), auth.Logger, "Policy for %s only has local requirements and needs a Verifier (WithJWKS); its calls are rejected", method)
+		}
+	}
+
+	if cfg.DefaultPolicy != nil && cfg.DefaultPolicy.localOnly() {
+		logErrorf(context.Background(), auth.Logger, "Default policy only has local requirements and needs a Verifier (WithJWKS); its calls are rejected")
+	}
+}
+
+// authorizePolicy checks pol for accessToken: through /v1/authorize unless pol only has local
+// requirements, then against pol.Scopes and pol.Claims, and last against pol.Condition with the
+// request attributes. Unmet requirements are reported as not authorized.
+func (auth *AuthClient) authorizePolicy(ctx context.Context, product string, pol Policy, accessToken string, request map[string]any) (*Principal, bool, int, error) {
+	var (
+		principal  *Principal
+		authorized = true
+		statusCode int
+		err        error
+	)
+
+	if pol.localOnly() {
+		principal, statusCode, err = auth.authenticateLocally(ctx, product, accessToken)
+	} else {
+		principal, authorized, statusCode, err = auth.authorizeToken(ctx, product, pol.Resource, pol.Action, accessToken, pol.Degradation)
+	}
+
+	if err != nil || !authorized {
+		return principal, false, statusCode, err
+	}
+
+	if !principal.satisfies(pol.Scopes, pol.Claims) {
+		return principal, false, http.StatusForbidden, nil
+	}
+
+	met, err := auth.meetsCondition(ctx, pol.Condition, principal, request)
+	if err != nil {
+		return principal, false, http.StatusInternalServerError, err
+	}
+
+	if !met {
+		return principal, false, http.StatusForbidden, nil
+	}
+
+	return principal, true, statusCode, nil
+}
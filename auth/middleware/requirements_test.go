@@ -0,0 +1,274 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ---------------------------------------------------------------------------
+// Principal.satisfies
+// ---------------------------------------------------------------------------
+
+func TestPrincipal_Satisfies(t *testing.T) {
+	t.Parallel()
+
+	p := newPrincipal(jwt.MapClaims{
+		"type": "normal-user", "scope": "ledgers:read accounts:read", "aud": []any{"midaz", "reporter"}, "level": float64(3), "admin": false,
+	}, "acme/user1")
+
+	tests := []struct {
+		name   string
+		scopes []string
+		claims map[string]string
+		want   bool
+	}{
+		{name: "no_requirements", want: true},
+		{name: "granted_scopes", scopes: []string{"ledgers:read", "accounts:read"}, want: true},
+		{name: "missing_scope", scopes: []string{"ledgers:read", "ledgers:write"}, want: false},
+		{name: "string_claim", claims: map[string]string{"type": "normal-user"}, want: true},
+		{name: "list_claim", claims: map[string]string{"aud": "reporter"}, want: true},
+		{name: "number_claim", claims: map[string]string{"level": "3"}, want: true},
+		{name: "bool_claim", claims: map[string]string{"admin": "false"}, want: true},
+		{name: "wrong_value", claims: map[string]string{"type": "application"}, want: false},
+		{name: "missing_claim", claims: map[string]string{"tenantId": ""}, want: false},
+		{name: "scopes_and_claims", scopes: []string{"ledgers:read"}, claims: map[string]string{"aud": "midaz"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, p.satisfies(tt.scopes, tt.claims))
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// RequireScopes / RequireClaims
+// ---------------------------------------------------------------------------
+
+func TestRequireScopes(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+
+	verifier, sign := newTestVerifier(t)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+	auth.Verifier = verifier
+
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) }
+
+	app := fiber.New()
+	app.Get("/read", auth.RequireScopes("ledgers:read"), ok)
+	app.Get("/write", auth.RequireScopes("ledgers:write"), ok)
+	app.Get("/users", auth.RequireClaims(map[string]string{"type": "normal-user", "aud": "midaz"}), ok)
+	app.Get("/apps", auth.RequireClaims(map[string]string{"type": "application"}), ok)
+
+	tests := []struct {
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{path: "/read", token: sign(userClaims()), wantStatus: http.StatusOK},
+		{path: "/write", token: sign(userClaims()), wantStatus: http.StatusForbidden},
+		{path: "/users", token: sign(userClaims()), wantStatus: http.StatusOK},
+		{path: "/apps", token: sign(userClaims()), wantStatus: http.StatusForbidden},
+		{path: "/read", wantStatus: http.StatusUnauthorized},
+		{path: "/read", token: "not-a-jwt", wantStatus: http.StatusUnauthorized},
+		{path: "/read", token: createTestJWT(userClaims()), wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		assert.Equal(t, tt.wantStatus, resp.StatusCode, tt.path)
+	}
+
+	assert.Equal(t, int32(0), server.calls.Load(), "local checks must not call the auth service")
+}
+
+func TestRequireScopes_WithoutVerifier(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+
+	auth := &AuthClient{Address: server.URL, Enabled: true, Logger: &testLogger{}}
+
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) }
+
+	app := fiber.New()
+	app.Get("/write", auth.RequireScopes("ledger:write"), ok)
+	app.Get("/ledgers", auth.Authorize("midaz", "ledgers", "get"), auth.RequireScopes("ledgers:read"), ok)
+
+	// A token signed with the attacker's own key must not pass an unverified local check.
+	forged := createTestJWT(jwt.MapClaims{"type": "normal-user", "owner": "acme", "sub": "user1", "scope": "ledger:write"})
+
+	tests := []struct {
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{path: "/write", token: forged, wantStatus: http.StatusInternalServerError},
+		{path: "/ledgers", token: createTestJWT(userClaims()), wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		assert.Equal(t, tt.wantStatus, resp.StatusCode, tt.path)
+	}
+
+	assert.Equal(t, int32(1), server.calls.Load(), "only the route composed with Authorize reaches the auth service")
+}
+
+func TestRequireScopes_AfterAuthorize(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+
+	app := fiber.New()
+	app.Get("/ledgers", auth.Authorize("midaz", "ledgers", "get"), auth.RequireScopes("ledgers:write"), func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/ledgers", nil)
+	req.Header.Set("Authorization", "Bearer "+createTestJWT(userClaims()))
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, int32(1), server.calls.Load())
+}
+
+func TestRequireScopes_DisabledClient(t *testing.T) {
+	t.Parallel()
+
+	auth := NewAuthClientWithOptions("http://plugin-auth:4000", WithEnabled(false), WithLogger(&testLogger{}))
+
+	app := fiber.New()
+	app.Get("/ledgers", auth.RequireScopes("ledgers:write"), func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/ledgers", nil))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// ---------------------------------------------------------------------------
+// gRPC policies
+// ---------------------------------------------------------------------------
+
+func TestGRPCPolicies_LocalRequirements(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		policy    Policy
+		wantCode  codes.Code
+		wantCalls int32
+	}{
+		{name: "local_scope_granted", policy: Policy{Scopes: []string{"ledgers:read"}}, wantCode: codes.OK},
+		{name: "local_scope_missing", policy: Policy{Scopes: []string{"ledgers:write"}}, wantCode: codes.PermissionDenied},
+		{name: "local_claim", policy: Policy{Claims: map[string]string{"type": "normal-user"}}, wantCode: codes.OK},
+		{name: "remote_and_local", policy: Policy{Resource: "ledgers", Action: "get", Scopes: []string{"ledgers:read"}}, wantCode: codes.OK, wantCalls: 1},
+		{name: "remote_then_local_denied", policy: Policy{Resource: "ledgers", Action: "get", Claims: map[string]string{"type": "application"}}, wantCode: codes.PermissionDenied, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newAuthServer(t)
+
+			verifier, sign := newTestVerifier(t)
+
+			auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+			auth.Verifier = verifier
+			cfg := PolicyConfig{DefaultPolicy: &tt.policy}
+
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+sign(userClaims())))
+
+			var principal *Principal
+
+			_, err := NewGRPCAuthUnaryPolicy(auth, cfg)(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Get"}, func(ctx context.Context, _ any) (any, error) {
+				principal, _ = PrincipalFromContext(ctx)
+
+				return "ok", nil
+			})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			assert.Equal(t, tt.wantCalls, server.calls.Load())
+
+			if tt.wantCode == codes.OK {
+				require.NotNil(t, principal)
+				assert.Equal(t, "acme/user1", principal.Subject)
+			}
+
+			err = NewGRPCAuthStreamPolicy(auth, cfg)(nil, &fakeServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/pkg.Service/Stream"},
+				func(any, grpc.ServerStream) error { return nil })
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
+
+func TestGRPCPolicies_LocalRequirementsWithoutVerifier(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+
+	auth := &AuthClient{Address: server.URL, Enabled: true, Logger: &testLogger{}}
+	cfg := PolicyConfig{MethodPolicies: map[string]Policy{
+		"/pkg.Ledgers/Delete": {Scopes: []string{"ledger:write"}},
+		"/pkg.Ledgers/Get":    {Resource: "ledgers", Action: "get", Scopes: []string{"ledgers:read"}},
+	}}
+
+	forged := createTestJWT(jwt.MapClaims{"type": "normal-user", "owner": "acme", "sub": "user1", "scope": "ledger:write"})
+
+	tests := []struct {
+		method   string
+		token    string
+		wantCode codes.Code
+	}{
+		{method: "/pkg.Ledgers/Delete", token: forged, wantCode: codes.Internal},
+		{method: "/pkg.Ledgers/Get", token: createTestJWT(userClaims()), wantCode: codes.OK},
+	}
+
+	for _, tt := range tests {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+tt.token))
+
+		_, err := NewGRPCAuthUnaryPolicy(auth, cfg)(ctx, "req", &grpc.UnaryServerInfo{FullMethod: tt.method}, func(context.Context, any) (any, error) {
+			return "ok", nil
+		})
+		assert.Equal(t, tt.wantCode, status.Code(err), tt.method)
+	}
+
+	assert.Equal(t, int32(1), server.calls.Load())
+}
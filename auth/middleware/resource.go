@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/LerianStudio/lib-observability/tracing"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errUnresolvedResource is returned when a resource template cannot be resolved for a request.
+var errUnresolvedResource = errors.New("resource template cannot be resolved")
+
+// isResourceTemplate reports whether resource has ":name" segments, e.g. "ledgers/:ledger_id".
+func isResourceTemplate(resource string) bool {
+	return slices.ContainsFunc(strings.Split(resource, "/"), func(segment string) bool {
+		return strings.HasPrefix(segment, ":")
+	})
+}
+
+// resolveResource replaces every ":name" segment of template with the value lookup returns for
+// name, e.g. "ledgers/:ledger_id/accounts/:id" becomes "ledgers/123/accounts/456". It fails with
+// 500 when lookup knows no such name, a misconfiguration, and with 400 when the value is empty, is
+// "." or "..", or contains "/", any of which would address another resource.
+func resolveResource(template string, lookup func(name string) (string, bool)) (string, int, error) {
+	segments := strings.Split(template, "/")
+
+	for i, segment := range segments {
+		name, ok := strings.CutPrefix(segment, ":")
+		if !ok {
+			continue
+		}
+
+		value, found := lookup(name)
+
+		switch {
+		case !found:
+			return "", http.StatusInternalServerError, fmt.Errorf("%w: %q has no %q", errUnresolvedResource, template, name)
+		case value == "" || value == "." || value == ".." || strings.Contains(value, "/"):
+			return "", http.StatusBadRequest, fmt.Errorf("%w: invalid %q for %q", errUnresolvedResource, name, template)
+		}
+
+		segments[i] = value
+	}
+
+	return strings.Join(segments, "/"), http.StatusOK, nil
+}
+
+// resolveFiberResource resolves the resource template from the route params of c.
+func (auth *AuthClient) resolveFiberResource(ctx context.Context, span trace.Span, c *fiber.Ctx, template string) (string, int, error) {
+	resource, statusCode, err := resolveResource(template, func(name string) (string, bool) {
+		if !slices.Contains(c.Route().Params, name) {
+			return "", false
+		}
+
+		return c.Params(name), true
+	})
+	if err != nil {
+		logErrorf(ctx, auth.Logger, "Failed to resolve resource: %v", err)
+
+		tracing.HandleSpanError(span, "Failed to resolve resource", err)
+	}
+
+	return resource, statusCode, err
+}
+
+// resolveGRPCResource resolves the resource template from the fields of the request message req,
+// returning a gRPC status error: InvalidArgument for missing values and Internal when the message
+// has no such field, including for streams, whose req is nil.
+func (auth *AuthClient) resolveGRPCResource(ctx context.Context, span trace.Span, template string, req any) (string, error) {
+	resource, statusCode, err := resolveResource(template, func(name string) (string, bool) {
+		return messageField(req, name)
+	})
+	if err != nil {
+		logErrorf(ctx, auth.Logger, "Failed to resolve resource: %v", err)
+
+		tracing.HandleSpanError(span, "Failed to resolve resource", err)
+
+		if statusCode == http.StatusBadRequest {
+			return "", status.Error(codes.InvalidArgument, "invalid resource identifier")
+		}
+
+		return "", status.Error(codes.Internal, "internal configuration error")
+	}
+
+	return resource, nil
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/apipb"
+	"google.golang.org/protobuf/types/known/sourcecontextpb"
+)
+
+// ---------------------------------------------------------------------------
+// resolveResource
+// ---------------------------------------------------------------------------
+
+func TestResolveResource(t *testing.T) {
+	t.Parallel()
+
+	values := map[string]string{"ledger_id": "123", "id": "456", "ledger.id": "789", "empty": "", "path": "1/../2", "dot": ".", "dotdot": ".."}
+
+	lookup := func(name string) (string, bool) {
+		v, ok := values[name]
+
+		return v, ok
+	}
+
+	tests := []struct {
+		template   string
+		want       string
+		wantStatus int
+	}{
+		{template: "ledgers", want: "ledgers", wantStatus: http.StatusOK},
+		{template: "ledgers/:ledger_id/accounts/:id", want: "ledgers/123/accounts/456", wantStatus: http.StatusOK},
+		{template: ":id", want: "456", wantStatus: http.StatusOK},
+		{template: "ledgers/:ledger.id", want: "ledgers/789", wantStatus: http.StatusOK},
+		{template: "ledgers/:unknown", wantStatus: http.StatusInternalServerError},
+		{template: "ledgers/:empty", wantStatus: http.StatusBadRequest},
+		{template: "ledgers/:path", wantStatus: http.StatusBadRequest},
+		{template: "ledgers/:dot", wantStatus: http.StatusBadRequest},
+		{template: "ledgers/:dotdot/accounts", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.template != "ledgers", isResourceTemplate(tt.template))
+
+			got, statusCode, err := resolveResource(tt.template, lookup)
+			assert.Equal(t, tt.wantStatus, statusCode)
+			assert.Equal(t, tt.want, got)
+
+			if tt.wantStatus != http.StatusOK {
+				require.ErrorIs(t, err, errUnresolvedResource)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Authorize with resource templates
+// ---------------------------------------------------------------------------
+
+func TestAuthorize_ResourceTemplate(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) }
+
+	app := fiber.New()
+	app.Get("/v1/ledgers/:ledger_id/accounts/:id", auth.Authorize("midaz", "ledgers/:ledger_id/accounts/:id", "get"), ok)
+	app.Get("/v1/ledgers/:ledger_id?", auth.Authorize("midaz", "ledgers/:ledger_id", "get"), ok)
+	app.Get("/v1/accounts", auth.Authorize("midaz", "accounts/:id", "get"), ok)
+
+	tests := []struct {
+		target     string
+		wantStatus int
+	}{
+		{target: "/v1/ledgers/123/accounts/456", wantStatus: http.StatusOK},
+		{target: "/v1/ledgers/", wantStatus: http.StatusBadRequest},
+		{target: "/v1/accounts", wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		req.Header.Set("Authorization", "Bearer "+createTestJWT(userClaims()))
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		assert.Equal(t, tt.wantStatus, resp.StatusCode, tt.target)
+	}
+
+	assert.Equal(t, []string{"ledgers/123/accounts/456"}, server.recorded())
+}
+
+// ---------------------------------------------------------------------------
+// gRPC policies with resource templates
+// ---------------------------------------------------------------------------
+
+func TestGRPCPolicy_ResourceTemplate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		resource     string
+		req          any
+		wantCode     codes.Code
+		wantResource string
+	}{
+		{name: "field", resource: "apis/:name/methods", req: &apipb.Api{Name: "pkg.Service"}, wantCode: codes.OK, wantResource: "apis/pkg.Service/methods"},
+		{
+			name:         "nested_json_name",
+			resource:     "apis/:name/files/:sourceContext.fileName",
+			req:          &apipb.Api{Name: "pkg.Service", SourceContext: &sourcecontextpb.SourceContext{FileName: "service.proto"}},
+			wantCode:     codes.OK,
+			wantResource: "apis/pkg.Service/files/service.proto",
+		},
+		{name: "empty_field", resource: "apis/:name", req: &apipb.Api{}, wantCode: codes.InvalidArgument},
+		{name: "unknown_field", resource: "apis/:api_id", req: &apipb.Api{Name: "pkg.Service"}, wantCode: codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newAuthServer(t)
+
+			auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}))
+			cfg := PolicyConfig{DefaultPolicy: &Policy{Resource: tt.resource, Action: "get"}}
+
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+createTestJWT(userClaims())))
+
+			_, err := NewGRPCAuthUnaryPolicy(auth, cfg)(ctx, tt.req, &grpc.UnaryServerInfo{FullMethod: "/pkg.Apis/Get"}, func(context.Context, any) (any, error) {
+				return "ok", nil
+			})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+
+			if tt.wantResource != "" {
+				assert.Equal(t, []string{tt.wantResource}, server.recorded())
+			} else {
+				assert.Empty(t, server.recorded())
+			}
+
+			// Streams carry no request message to resolve templates from.
+			err = NewGRPCAuthStreamPolicy(auth, cfg)(nil, &fakeServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/pkg.Apis/Watch"},
+				func(any, grpc.ServerStream) error { return nil })
+			assert.Equal(t, codes.Internal, status.Code(err))
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 2 * time.Second
+	defaultRetryMultiplier     = 2.0
+)
+
+// RetryConfig configures retries of transient auth service failures: network errors and
+// 502/503/504 responses. Backoff grows exponentially with full jitter, a Retry-After header
+// overrides the computed delay, and no retry is attempted past the caller's context deadline.
+// - MaxAttempts is the total number of attempts, including the first (default 3).
+// - InitialBackoff is the upper bound of the first delay (default 100ms).
+// - MaxBackoff caps every delay, including Retry-After (default 2s).
+// - Multiplier grows the delay bound between attempts (default 2).
+type RetryConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+// withDefaults returns a copy of cfg with zero-valued settings replaced by defaults.
+func (cfg RetryConfig) withDefaults() RetryConfig {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultRetryMaxAttempts
+	}
+
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = defaultRetryInitialBackoff
+	}
+
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultRetryMaxBackoff
+	}
+
+	if cfg.Multiplier < 1 {
+		cfg.Multiplier = defaultRetryMultiplier
+	}
+
+	return cfg
+}
+
+// backoff returns the jittered delay before retry number attempt (1-based).
+func (cfg RetryConfig) backoff(attempt int) time.Duration {
+	bound := float64(cfg.InitialBackoff)
+	for range attempt - 1 {
+		bound *= cfg.Multiplier
+	}
+
+	if bound > float64(cfg.MaxBackoff) {
+		bound = float64(cfg.MaxBackoff)
+	}
+
+	return time.Duration(rand.Int64N(int64(bound) + 1)) //nolint:gosec // jitter does not need a CSPRNG
+}
+
+// noRetryKey marks a context whose requests must not be retried.
+type noRetryKey struct{}
+
+// withoutRetry returns ctx marked so that sendWithRetry sends its requests once, e.g. for a
+// refresh token the auth service may rotate: replaying it after a lost response would reuse it.
+func withoutRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+// isRetryableStatus reports whether the auth service status is a transient gateway failure.
+func isRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseRetryAfter reads a Retry-After header in delay-seconds or HTTP-date form.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+
+	return 0, false
+}
+
+// do sends req through the circuit breaker, when configured, and then sendWithRetry.
+// While the breaker is open it fails with ErrCircuitOpen without touching the network.
+func (auth *AuthClient) do(span trace.Span, req *http.Request) (*http.Response, error) {
+	if auth.breaker == nil {
+		return auth.sendWithRetry(span, req)
+	}
+
+	done, err := auth.breaker.allow()
+
+	span.SetAttributes(attribute.String("app.auth.circuit_breaker.state", string(auth.CircuitBreakerState())))
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := auth.sendWithRetry(span, req)
+	done(resp, err)
+
+	return resp, err
+}
+
+// sendWithRetry sends req with the client's HTTP client, retrying transient failures when auth.Retry
+// is set and req's context is not marked withoutRetry. Each attempt is recorded as a span event.
+// The request body is replayed through req.GetBody.
+func (auth *AuthClient) sendWithRetry(span trace.Span, req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	client := auth.client()
+
+	if noRetry, _ := ctx.Value(noRetryKey{}).(bool); auth.Retry == nil || noRetry {
+		return client.Do(req)
+	}
+
+	cfg := auth.Retry.withDefaults()
+
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to replay request body: %w", err)
+			}
+
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+
+		resp, err := client.Do(attemptReq)
+
+		attrs := []attribute.KeyValue{attribute.Int("app.auth.retry.attempt", attempt)}
+
+		var (
+			retryable, hasRetryAfter bool
+			retryAfter               time.Duration
+		)
+
+		switch {
+		case err != nil:
+			attrs = append(attrs, attribute.String("app.auth.retry.error", err.Error()))
+			retryable = ctx.Err() == nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+		default:
+			attrs = append(attrs, attribute.Int("app.auth.retry.status_code", resp.StatusCode))
+			retryable = isRetryableStatus(resp.StatusCode)
+			retryAfter, hasRetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+
+		if !retryable || attempt >= cfg.MaxAttempts {
+			span.AddEvent("lib_auth.request_attempt", trace.WithAttributes(attrs...))
+
+			return resp, err
+		}
+
+		delay := cfg.backoff(attempt)
+		if hasRetryAfter {
+			delay = min(retryAfter, cfg.MaxBackoff)
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			// Waiting would outlive the caller; surface the last outcome instead.
+			span.AddEvent("lib_auth.request_attempt", trace.WithAttributes(attrs...))
+
+			return resp, err
+		}
+
+		attrs = append(attrs, attribute.Int64("app.auth.retry.backoff_ms", delay.Milliseconds()))
+		span.AddEvent("lib_auth.request_attempt", trace.WithAttributes(attrs...))
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
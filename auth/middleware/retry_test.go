@@ -0,0 +1,225 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	observability "github.com/LerianStudio/lib-observability"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func fastRetry() *RetryConfig {
+	return &RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+}
+
+func TestCheckAuthorization_Retry(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		failures   int32
+		failStatus int
+		retry      *RetryConfig
+		wantCalls  int32
+		wantErr    bool
+	}{
+		{name: "retries_503_until_success", failures: 2, failStatus: http.StatusServiceUnavailable, retry: fastRetry(), wantCalls: 3},
+		{name: "retries_502", failures: 1, failStatus: http.StatusBadGateway, retry: fastRetry(), wantCalls: 2},
+		{name: "retries_504", failures: 1, failStatus: http.StatusGatewayTimeout, retry: fastRetry(), wantCalls: 2},
+		{name: "retries_network_error", failures: 1, failStatus: 0, retry: fastRetry(), wantCalls: 2},
+		{name: "gives_up_after_max_attempts", failures: 5, failStatus: http.StatusServiceUnavailable, retry: fastRetry(), wantCalls: 3, wantErr: true},
+		{name: "does_not_retry_500", failures: 1, failStatus: http.StatusInternalServerError, retry: fastRetry(), wantCalls: 1, wantErr: true},
+		{name: "disabled_without_config", failures: 1, failStatus: http.StatusServiceUnavailable, retry: nil, wantCalls: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newAuthServer(t)
+			server.failFirst(tt.failures, tt.failStatus, nil)
+
+			auth := &AuthClient{
+				Address: server.URL,
+				Enabled: true,
+				Logger:  &testLogger{},
+				Retry:   tt.retry,
+			}
+
+			token := createTestJWT(jwt.MapClaims{"type": "normal-user", "owner": "org1", "sub": "user1"})
+
+			authorized, _, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", "get", token)
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.False(t, authorized)
+			} else {
+				require.NoError(t, err)
+				assert.True(t, authorized)
+			}
+
+			assert.Equal(t, tt.wantCalls, server.calls.Load())
+		})
+	}
+}
+
+func TestCheckAuthorization_Retry_RecordsAttemptsOnSpan(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+	server.failFirst(2, http.StatusServiceUnavailable, nil)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { require.NoError(t, tp.Shutdown(context.Background())) })
+
+	auth := &AuthClient{Address: server.URL, Enabled: true, Logger: &testLogger{}, Retry: fastRetry()}
+
+	token := createTestJWT(jwt.MapClaims{"type": "normal-user", "owner": "org1", "sub": "user1"})
+	ctx := observability.ContextWithTracer(context.Background(), tp.Tracer("test"))
+
+	_, _, err := auth.checkAuthorization(ctx, "midaz", "ledgers", "get", token)
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+
+	var attempts []int64
+
+	for _, event := range spans[0].Events {
+		if event.Name != "lib_auth.request_attempt" {
+			continue
+		}
+
+		for _, attr := range event.Attributes {
+			if attr.Key == "app.auth.retry.attempt" {
+				attempts = append(attempts, attr.Value.AsInt64())
+			}
+		}
+	}
+
+	assert.Equal(t, []int64{1, 2, 3}, attempts)
+}
+
+func TestCheckAuthorization_Retry_RetryAfterBeyondDeadline(t *testing.T) {
+	t.Parallel()
+
+	server := newAuthServer(t)
+	server.failFirst(5, http.StatusServiceUnavailable, http.Header{"Retry-After": []string{"2"}})
+
+	auth := &AuthClient{
+		Address: server.URL,
+		Enabled: true,
+		Logger:  &testLogger{},
+		Retry:   &RetryConfig{MaxAttempts: 5, MaxBackoff: 10 * time.Second},
+	}
+
+	token := createTestJWT(jwt.MapClaims{"type": "normal-user", "owner": "org1", "sub": "user1"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	_, _, err := auth.checkAuthorization(ctx, "midaz", "ledgers", "get", token)
+	require.Error(t, err)
+	assert.Equal(t, int32(1), server.calls.Load(), "a Retry-After beyond the deadline must not be waited for")
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestGetApplicationToken_Retry(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(oauth2Token{AccessToken: "app-token"})
+	}))
+	defer server.Close()
+
+	auth := &AuthClient{Address: server.URL, Enabled: true, Logger: &testLogger{}, Retry: fastRetry()}
+
+	token, err := auth.GetApplicationToken(context.Background(), "id", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "app-token", token)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestRefreshAndRevoke_NotRetried(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	auth := &AuthClient{Address: server.URL, Enabled: true, Logger: &testLogger{}, Retry: fastRetry()}
+
+	_, err := auth.RefreshApplicationToken(context.Background(), "id", "secret", "refresh-token")
+	require.Error(t, err)
+	assert.Equal(t, int32(1), calls.Load())
+
+	require.Error(t, auth.RevokeToken(context.Background(), "id", "secret", "refresh-token", "refresh_token"))
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{name: "empty", value: "", want: 0, ok: false},
+		{name: "seconds", value: "3", want: 3 * time.Second, ok: true},
+		{name: "negative_seconds", value: "-1", want: 0, ok: false},
+		{name: "http_date", value: now.Add(5 * time.Second).Format(http.TimeFormat), want: 5 * time.Second, ok: true},
+		{name: "past_http_date", value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0, ok: true},
+		{name: "garbage", value: "soon", want: 0, ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := parseRetryAfter(tt.value, now)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRetryConfig_Backoff(t *testing.T) {
+	t.Parallel()
+
+	cfg := RetryConfig{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}.withDefaults()
+
+	for attempt, bound := range map[int]time.Duration{1: 10 * time.Millisecond, 2: 20 * time.Millisecond, 3: 40 * time.Millisecond, 6: 50 * time.Millisecond} {
+		for range 100 {
+			delay := cfg.backoff(attempt)
+			assert.GreaterOrEqual(t, delay, time.Duration(0))
+			assert.LessOrEqual(t, delay, bound)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package middleware
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/LerianStudio/lib-observability/tracing"
+	"github.com/gofiber/fiber/v2"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	// ErrMissingTenant is returned when MultiTenantConfig.Required is set and the token has no tenant.
+	ErrMissingTenant = errors.New("token has no tenant")
+	// ErrTenantMismatch is returned when the tenant targeted by the request is not the token's tenant.
+	ErrTenantMismatch = errors.New("token tenant does not match the requested tenant")
+)
+
+// tenantKey keys the request Tenant in Fiber locals and in contexts.
+type tenantKey struct{}
+
+// Tenant identifies the tenant of an authenticated request, read from the token claims named by
+// MultiTenantConfig.Claims. It is propagated by Authorize and the gRPC policy interceptors when
+// multi-tenancy is enabled.
+type Tenant struct {
+	ID    string
+	Slug  string
+	Owner string
+}
+
+// IsZero reports whether none of the tenant fields are set.
+func (t Tenant) IsZero() bool {
+	return t == Tenant{}
+}
+
+// TenantHeaders names the request headers Authorize sets from the tenant claims, so proxies
+// forwarding the request pass the tenant downstream. Empty names are not set. Values sent by
+// the client under these names are always removed, so they cannot be spoofed.
+type TenantHeaders struct {
+	ID    string
+	Slug  string
+	Owner string
+}
+
+// TenantClaims names the token claims holding the tenant. Empty names default to "tenantId",
+// "tenantSlug" and "owner".
+type TenantClaims struct {
+	ID    string
+	Slug  string
+	Owner string
+}
+
+// TenantMetadataKeys names the incoming gRPC metadata keys the interceptors set from the tenant
+// claims. Empty keys default to "md-tenant-id", "md-tenant-slug" and "md-tenant-owner".
+type TenantMetadataKeys struct {
+	ID    string
+	Slug  string
+	Owner string
+}
+
+// TenantSource locates the tenant ID targeted by a request. Every configured location present in
+// the request must name the token's tenant; requests naming none are not checked.
+// - PathParam is a Fiber route parameter, e.g. "tenantId" for "/v1/tenants/:tenantId/ledgers".
+// - Header is an HTTP request header, read by Authorize.
+// - MetadataKey is a gRPC incoming metadata key.
+// - Field is a field of the unary gRPC request message, e.g. "tenant_id" or "ledger.tenant_id".
+type TenantSource struct {
+	PathParam   string
+	Header      string
+	MetadataKey string
+	Field       string
+}
+
+// fromFiber returns the tenant IDs targeted by the request in c.
+func (s TenantSource) fromFiber(c *fiber.Ctx) []string {
+	var requested []string
+
+	if s.PathParam != "" {
+		requested = appendNonEmpty(requested, c.Params(s.PathParam))
+	}
+
+	if s.Header != "" {
+		requested = appendNonEmpty(requested, c.Get(s.Header))
+	}
+
+	return requested
+}
+
+// fromGRPC returns the tenant IDs targeted by the call in ctx with request message req, which
+// is nil for streams.
+func (s TenantSource) fromGRPC(ctx context.Context, req any) []string {
+	var requested []string
+
+	if s.MetadataKey != "" {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if vals := md.Get(strings.ToLower(s.MetadataKey)); len(vals) > 0 {
+				requested = appendNonEmpty(requested, vals[0])
+			}
+		}
+	}
+
+	if s.Field != "" {
+		if value, ok := messageField(req, s.Field); ok {
+			requested = appendNonEmpty(requested, value)
+		}
+	}
+
+	return requested
+}
+
+func appendNonEmpty(values []string, value string) []string {
+	if value == "" {
+		return values
+	}
+
+	return append(values, value)
+}
+
+// WithTenantGuard rejects requests to one route targeting another tenant than the token's with
+// 403, overriding MultiTenantConfig.Match. The guard applies even when multi-tenancy is disabled.
+func WithTenantGuard(source TenantSource) AuthorizeOption {
+	return func(c *authorizeConfig) {
+		c.tenantGuard = &source
+	}
+}
+
+// MultiTenantConfig configures tenant propagation and enforcement. Set it on the AuthClient with
+// WithMultiTenant and override it per server with PolicyConfig.MultiTenant. Only NewAuthClient and
+// NewAuthClientWithOptions read MULTI_TENANT_ENABLED; an AuthClient built as a struct literal must
+// set Enabled itself.
+// - Enabled propagates the token's Tenant to handlers (context, Fiber locals, gRPC metadata).
+// - Required rejects tokens without a tenant ID with 401/Unauthenticated.
+// - Claims and MetadataKeys rename the tenant claims and the gRPC metadata keys.
+// - Match rejects requests targeting another tenant than the token's with 403/PermissionDenied.
+// - Admins lists platform-admin identities allowed to target any tenant, e.g. client IDs.
+// - AdminClaim names the token claim Admins are matched against; defaults to "sub".
+type MultiTenantConfig struct {
+	Enabled      bool
+	Required     bool
+	Claims       TenantClaims
+	MetadataKeys TenantMetadataKeys
+	Match        TenantSource
+	Admins       []string
+	AdminClaim   string
+}
+
+// withDefaults fills in the default claim names and metadata keys left empty.
+func (mt MultiTenantConfig) withDefaults() MultiTenantConfig {
+	mt.Claims.ID = cmp.Or(mt.Claims.ID, "tenantId")
+	mt.Claims.Slug = cmp.Or(mt.Claims.Slug, "tenantSlug")
+	mt.Claims.Owner = cmp.Or(mt.Claims.Owner, "owner")
+
+	mt.MetadataKeys.ID = cmp.Or(mt.MetadataKeys.ID, "md-tenant-id")
+	mt.MetadataKeys.Slug = cmp.Or(mt.MetadataKeys.Slug, "md-tenant-slug")
+	mt.MetadataKeys.Owner = cmp.Or(mt.MetadataKeys.Owner, "md-tenant-owner")
+
+	mt.AdminClaim = cmp.Or(mt.AdminClaim, "sub")
+
+	return mt
+}
+
+// tenantFrom reads the Tenant from already parsed token claims.
+func (mt MultiTenantConfig) tenantFrom(claims jwt.MapClaims) Tenant {
+	var tenant Tenant
+
+	tenant.ID, _ = claims[mt.Claims.ID].(string)
+	tenant.Slug, _ = claims[mt.Claims.Slug].(string)
+	tenant.Owner, _ = claims[mt.Claims.Owner].(string)
+
+	return tenant
+}
+
+// resolve reads the tenant of p, recording it on p, and checks it against Required and against
+// requested, the tenant IDs targeted by the request. It returns the HTTP status to reject the
+// request with on error.
+func (mt MultiTenantConfig) resolve(ctx context.Context, auth *AuthClient, span trace.Span, p *Principal, requested []string) (Tenant, int, error) {
+	tenant := mt.tenantFrom(p.Claims)
+
+	p.TenantID, p.TenantSlug = tenant.ID, tenant.Slug
+
+	if mt.Enabled && mt.Required && tenant.ID == "" {
+		logErrorf(ctx, auth.Logger, "Missing %s claim in token", mt.Claims.ID)
+
+		tracing.HandleSpanError(span, "Missing tenant claim in token", ErrMissingTenant)
+
+		return tenant, http.StatusUnauthorized, ErrMissingTenant
+	}
+
+	for _, target := range requested {
+		if target == tenant.ID {
+			continue
+		}
+
+		// The authorization subject of application tokens is derived from the requested product,
+		// so admins are identified by a claim of the token itself.
+		if admin, _ := p.Claims[mt.AdminClaim].(string); admin != "" && slices.Contains(mt.Admins, admin) {
+			logWarnf(ctx, auth.Logger, "AUDIT: admin %s of tenant %q accessing tenant %q", admin, tenant.ID, target)
+
+			span.SetAttributes(attribute.Bool("app.auth.tenant.cross_tenant", true))
+
+			continue
+		}
+
+		logWarnf(ctx, auth.Logger, "Subject %s of tenant %q requested tenant %q", p.Subject, tenant.ID, target)
+
+		tracing.HandleSpanError(span, "Token tenant does not match the requested tenant", ErrTenantMismatch)
+
+		return tenant, http.StatusForbidden, ErrTenantMismatch
+	}
+
+	return tenant, http.StatusOK, nil
+}
+
+// ContextWithTenant returns a copy of ctx carrying t.
+func ContextWithTenant(ctx context.Context, t Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+// TenantFromContext returns the Tenant stored in ctx by Authorize (through c.UserContext()),
+// the gRPC policy interceptors or ContextWithTenant.
+func TenantFromContext(ctx context.Context) (Tenant, bool) {
+	if ctx == nil {
+		return Tenant{}, false
+	}
+
+	t, ok := ctx.Value(tenantKey{}).(Tenant)
+
+	return t, ok
+}
+
+// TenantFromFiber returns the Tenant stored in c by Authorize. It is absent unless multi-tenancy
+// is enabled and the token carries tenant claims.
+func TenantFromFiber(c *fiber.Ctx) (Tenant, bool) {
+	t, ok := c.Locals(tenantKey{}).(Tenant)
+
+	return t, ok
+}
+
+// propagateFiberTenant applies the client's MultiTenantConfig to the authorized request in c:
+// it enforces the tenant of p against guard (or Match when nil), stores it in c's locals and
+// user context and sets the configured tenant headers on the request. It returns the HTTP
+// status to reject the request with on error.
+func (auth *AuthClient) propagateFiberTenant(ctx context.Context, c *fiber.Ctx, span trace.Span, p *Principal, guard *TenantSource) (int, error) {
+	mt := auth.MultiTenant.withDefaults()
+
+	source := mt.Match
+	if guard != nil {
+		source = *guard
+	}
+
+	// The targeted tenant is read before the tenant headers are cleared, in case they overlap.
+	requested := source.fromFiber(c)
+
+	headers := auth.tenantHeaders
+
+	for _, name := range []string{headers.ID, headers.Slug, headers.Owner} {
+		if name != "" {
+			c.Request().Header.Del(name)
+		}
+	}
+
+	if !mt.Enabled && guard == nil {
+		return http.StatusOK, nil
+	}
+
+	tenant, statusCode, err := mt.resolve(ctx, auth, span, p, requested)
+	if err != nil || !mt.Enabled || tenant.IsZero() {
+		return statusCode, err
+	}
+
+	c.Locals(tenantKey{}, tenant)
+	c.SetUserContext(ContextWithTenant(c.UserContext(), tenant))
+
+	for name, value := range map[string]string{headers.ID: tenant.ID, headers.Slug: tenant.Slug, headers.Owner: tenant.Owner} {
+		if name != "" && value != "" {
+			c.Request().Header.Set(name, value)
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+// propagateGRPCTenant applies mt to the authorized call in ctx with request message req (nil for
+// streams): it enforces the tenant of p against guard (or mt.Match when nil) and copies it into
+// ctx and its incoming metadata, in place of any tenant metadata sent by the client. It returns a
+// gRPC status error on rejection.
+func (auth *AuthClient) propagateGRPCTenant(ctx context.Context, span trace.Span, mt MultiTenantConfig, p *Principal, guard *TenantSource, req any) (context.Context, error) {
+	mt = mt.withDefaults()
+
+	source := mt.Match
+	if guard != nil {
+		source = *guard
+	}
+
+	// The targeted tenant is read before the tenant metadata is cleared, in case they overlap.
+	requested := source.fromGRPC(ctx, req)
+
+	ctx = withTenantMetadata(ctx, Tenant{}, mt.MetadataKeys)
+
+	if !mt.Enabled && guard == nil {
+		return ctx, nil
+	}
+
+	tenant, statusCode, err := mt.resolve(ctx, auth, span, p, requested)
+	if err != nil {
+		return ctx, grpcErrorFromHTTP(statusCode)
+	}
+
+	if !mt.Enabled {
+		return ctx, nil
+	}
+
+	return withTenantMetadata(ctx, tenant, mt.MetadataKeys), nil
+}
+
+// withTenantMetadata replaces keys in the incoming metadata of ctx with tenant, and stores it in ctx.
+// Keys for which tenant has no value are removed.
+func withTenantMetadata(ctx context.Context, tenant Tenant, keys TenantMetadataKeys) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	md = md.Copy()
+
+	md.Delete(keys.ID)
+	md.Delete(keys.Slug)
+	md.Delete(keys.Owner)
+
+	if tenant.ID != "" {
+		md.Set(keys.ID, tenant.ID)
+	}
+
+	if tenant.Slug != "" {
+		md.Set(keys.Slug, tenant.Slug)
+	}
+
+	if tenant.Owner != "" {
+		md.Set(keys.Owner, tenant.Owner)
+	}
+
+	ctx = metadata.NewIncomingContext(ctx, md)
+
+	if tenant.IsZero() {
+		return ctx
+	}
+
+	return ContextWithTenant(ctx, tenant)
+}
@@ -0,0 +1,488 @@
+package middleware
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/typepb"
+)
+
+// tenantRequest is what a handler behind Authorize observed about the tenant.
+type tenantRequest struct {
+	status      int
+	fromFiber   Tenant
+	fromContext Tenant
+	found       bool
+	headers     map[string]string
+}
+
+// serveTenantRequest authorizes a GET of path bearing token (and any spoofed headers) with a
+// client built with opts, returning what the handler observed.
+func serveTenantRequest(t *testing.T, path, token string, spoofed map[string]string, opts ...Option) tenantRequest {
+	t.Helper()
+
+	server := mockAuthServer(t, true, http.StatusOK)
+	t.Cleanup(server.Close)
+
+	auth := NewAuthClientWithOptions(server.URL, append([]Option{WithHealthCheck(false), WithLogger(&testLogger{})}, opts...)...)
+
+	var got tenantRequest
+
+	handler := func(c *fiber.Ctx) error {
+		got.fromFiber, got.found = TenantFromFiber(c)
+		got.fromContext, _ = TenantFromContext(c.UserContext())
+		got.headers = map[string]string{
+			"X-Tenant-Id":    c.Get("X-Tenant-Id"),
+			"X-Tenant-Slug":  c.Get("X-Tenant-Slug"),
+			"X-Tenant-Owner": c.Get("X-Tenant-Owner"),
+		}
+
+		return c.SendStatus(http.StatusOK)
+	}
+
+	app := fiber.New()
+	app.Get("/ledgers", auth.Authorize("midaz", "ledgers", "get"), handler)
+	app.Get("/tenants/:tenantId/ledgers", auth.Authorize("midaz", "ledgers", "get"), handler)
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	for name, value := range spoofed {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	got.status = resp.StatusCode
+
+	return got
+}
+
+// tenantClaims place userClaims in tenant t-1.
+var tenantClaims = jwt.MapClaims{"tenantId": "t-1", "tenantSlug": "acme-prod"}
+
+// ---------------------------------------------------------------------------
+// Authorize
+// ---------------------------------------------------------------------------
+
+func TestAuthorize_TenantPropagation(t *testing.T) {
+	t.Parallel()
+
+	token := createTestJWT(userClaims(tenantClaims))
+
+	headers := WithTenantHeaders(TenantHeaders{ID: "X-Tenant-Id", Slug: "X-Tenant-Slug"})
+	spoofed := map[string]string{"X-Tenant-Id": "other-tenant", "X-Tenant-Owner": "other-owner"}
+
+	t.Run("multi_tenant_enabled", func(t *testing.T) {
+		t.Parallel()
+
+		got := serveTenantRequest(t, "/ledgers", token, spoofed, headers, WithMultiTenant(MultiTenantConfig{Enabled: true}))
+
+		want := Tenant{ID: "t-1", Slug: "acme-prod", Owner: "acme"}
+
+		require.Equal(t, http.StatusOK, got.status)
+		assert.True(t, got.found)
+		assert.Equal(t, want, got.fromFiber)
+		assert.Equal(t, want, got.fromContext)
+		assert.Equal(t, map[string]string{
+			"X-Tenant-Id":    "t-1",
+			"X-Tenant-Slug":  "acme-prod",
+			"X-Tenant-Owner": "other-owner", // not a configured header, left untouched
+		}, got.headers)
+	})
+
+	t.Run("token_without_tenant", func(t *testing.T) {
+		t.Parallel()
+
+		token := createTestJWT(jwt.MapClaims{"type": "application", "sub": "app1"})
+
+		got := serveTenantRequest(t, "/ledgers", token, spoofed, headers, WithMultiTenant(MultiTenantConfig{Enabled: true}))
+
+		require.Equal(t, http.StatusOK, got.status)
+		assert.False(t, got.found)
+		assert.Empty(t, got.headers["X-Tenant-Id"], "spoofed tenant headers must be removed")
+	})
+
+	t.Run("multi_tenant_disabled", func(t *testing.T) {
+		t.Parallel()
+
+		got := serveTenantRequest(t, "/ledgers", token, spoofed, headers, WithMultiTenant(MultiTenantConfig{}))
+
+		require.Equal(t, http.StatusOK, got.status)
+		assert.False(t, got.found)
+		assert.Empty(t, got.headers["X-Tenant-Id"], "spoofed tenant headers must be removed")
+		assert.Empty(t, got.headers["X-Tenant-Slug"])
+	})
+
+	t.Run("custom_claims", func(t *testing.T) {
+		t.Parallel()
+
+		token := createTestJWT(jwt.MapClaims{"type": "application", "sub": "app1", "org": "t-9"})
+
+		got := serveTenantRequest(t, "/ledgers", token, nil, WithMultiTenant(MultiTenantConfig{
+			Enabled: true,
+			Claims:  TenantClaims{ID: "org"},
+		}))
+
+		require.Equal(t, http.StatusOK, got.status)
+		assert.Equal(t, Tenant{ID: "t-9"}, got.fromFiber)
+	})
+}
+
+func TestAuthorize_TenantEnforcement(t *testing.T) {
+	t.Parallel()
+
+	token := createTestJWT(userClaims(tenantClaims))
+
+	enforced := WithMultiTenant(MultiTenantConfig{Enabled: true, Required: true, Match: TenantSource{PathParam: "tenantId"}})
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "matching_tenant", path: "/tenants/t-1/ledgers", token: token, wantStatus: http.StatusOK},
+		{name: "route_without_tenant", path: "/ledgers", token: token, wantStatus: http.StatusOK},
+		{name: "other_tenant", path: "/tenants/t-2/ledgers", token: token, wantStatus: http.StatusForbidden},
+		{name: "slug_is_not_the_tenant_id", path: "/tenants/acme-prod/ledgers", token: token, wantStatus: http.StatusForbidden},
+		{
+			name:       "missing_tenant",
+			path:       "/ledgers",
+			token:      createTestJWT(jwt.MapClaims{"type": "normal-user", "owner": "acme", "sub": "user1"}),
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := serveTenantRequest(t, tt.path, tt.token, nil, enforced)
+
+			assert.Equal(t, tt.wantStatus, got.status)
+			assert.Equal(t, tt.wantStatus == http.StatusOK, got.found)
+		})
+	}
+}
+
+func TestNewAuthClientWithOptions_MultiTenantFromEnv(t *testing.T) {
+	t.Setenv("MULTI_TENANT_ENABLED", "true")
+
+	auth := NewAuthClientWithOptions("http://plugin-auth:4000", WithHealthCheck(false), WithLogger(&testLogger{}))
+	assert.True(t, auth.MultiTenant.Enabled)
+
+	auth = NewAuthClientWithOptions("http://plugin-auth:4000", WithHealthCheck(false), WithLogger(&testLogger{}), WithMultiTenant(MultiTenantConfig{}))
+	assert.False(t, auth.MultiTenant.Enabled, "an explicit configuration wins over the environment")
+}
+
+// ---------------------------------------------------------------------------
+// gRPC interceptors
+// ---------------------------------------------------------------------------
+
+func TestNewGRPCAuthUnaryPolicy_TenantEnforcement(t *testing.T) {
+	t.Parallel()
+
+	token := createTestJWT(userClaims(tenantClaims))
+
+	server := mockAuthServer(t, true, http.StatusOK)
+	t.Cleanup(server.Close)
+
+	// The client does not enable multi-tenancy; PolicyConfig.MultiTenant overrides it.
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}), WithMultiTenant(MultiTenantConfig{}))
+
+	interceptor := NewGRPCAuthUnaryPolicy(auth, PolicyConfig{
+		DefaultPolicy: &Policy{Resource: "ledgers", Action: "get"},
+		MultiTenant: &MultiTenantConfig{
+			Enabled:      true,
+			Required:     true,
+			MetadataKeys: TenantMetadataKeys{ID: "x-tenant-id"},
+			Match:        TenantSource{MetadataKey: "X-Target-Tenant"},
+		},
+	})
+
+	tests := []struct {
+		name     string
+		token    string
+		target   string
+		wantCode codes.Code
+	}{
+		{name: "matching_tenant", token: token, target: "t-1", wantCode: codes.OK},
+		{name: "no_target", token: token, wantCode: codes.OK},
+		{name: "other_tenant", token: token, target: "t-2", wantCode: codes.PermissionDenied},
+		{name: "missing_tenant", token: createTestJWT(jwt.MapClaims{"type": "application", "sub": "app1"}), wantCode: codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			md := metadata.Pairs("authorization", "Bearer "+tt.token)
+			if tt.target != "" {
+				md.Set("x-target-tenant", tt.target)
+			}
+
+			var captured context.Context
+
+			_, err := interceptor(metadata.NewIncomingContext(context.Background(), md), "req", &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Get"}, func(ctx context.Context, _ any) (any, error) {
+				captured = ctx
+
+				return "ok", nil
+			})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+
+			if tt.wantCode != codes.OK {
+				assert.Nil(t, captured)
+
+				return
+			}
+
+			incoming, _ := metadata.FromIncomingContext(captured)
+			assert.Equal(t, []string{"t-1"}, incoming.Get("x-tenant-id"))
+			assert.Empty(t, incoming.Get("md-tenant-id"))
+			assert.Equal(t, []string{"acme-prod"}, incoming.Get("md-tenant-slug"), "unset keys keep their default")
+			assert.Empty(t, incoming.Get(""))
+		})
+	}
+}
+
+func TestGRPCPolicies_TenantMetadataNotSpoofable(t *testing.T) {
+	t.Parallel()
+
+	// The token has an owner but no tenant claims.
+	token := createTestJWT(userClaims())
+
+	server := mockAuthServer(t, true, http.StatusOK)
+	t.Cleanup(server.Close)
+
+	auth := NewAuthClientWithOptions(server.URL, WithHealthCheck(false), WithLogger(&testLogger{}), WithMultiTenant(MultiTenantConfig{Enabled: true}))
+	cfg := PolicyConfig{DefaultPolicy: &Policy{Resource: "ledgers", Action: "get"}}
+
+	md := metadata.Pairs(
+		"authorization", "Bearer "+token,
+		"md-tenant-id", "victim",
+		"md-tenant-slug", "victim-prod",
+		"md-tenant-owner", "victim-owner",
+	)
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+
+	assertNotSpoofed := func(t *testing.T, captured context.Context) {
+		t.Helper()
+
+		require.NotNil(t, captured)
+
+		incoming, _ := metadata.FromIncomingContext(captured)
+		assert.Empty(t, incoming.Get("md-tenant-id"))
+		assert.Empty(t, incoming.Get("md-tenant-slug"))
+		assert.Equal(t, []string{"acme"}, incoming.Get("md-tenant-owner"))
+	}
+
+	t.Run("unary", func(t *testing.T) {
+		t.Parallel()
+
+		var captured context.Context
+
+		_, err := NewGRPCAuthUnaryPolicy(auth, cfg)(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Get"}, func(ctx context.Context, _ any) (any, error) {
+			captured = ctx
+
+			return "ok", nil
+		})
+		require.NoError(t, err)
+
+		assertNotSpoofed(t, captured)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		t.Parallel()
+
+		var captured context.Context
+
+		err := NewGRPCAuthStreamPolicy(auth, cfg)(nil, &fakeServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/pkg.Service/Stream"}, func(_ any, ss grpc.ServerStream) error {
+			captured = ss.Context()
+
+			return nil
+		})
+		require.NoError(t, err)
+
+		assertNotSpoofed(t, captured)
+	})
+}
+
+// ---------------------------------------------------------------------------
+// Tenant guard
+// ---------------------------------------------------------------------------
+
+// adminToken is an M2M token of the "platform" client, issued to tenant t-0. Its authorization
+// subject is "admin/midaz-editor-role", as for any application calling midaz.
+func adminToken() string {
+	return createTestJWT(jwt.MapClaims{"type": "application", "sub": "platform", "tenantId": "t-0"})
+}
+
+func TestAuthorize_TenantGuard(t *testing.T) {
+	t.Parallel()
+
+	token := createTestJWT(userClaims(tenantClaims))
+
+	server := mockAuthServer(t, true, http.StatusOK)
+	t.Cleanup(server.Close)
+
+	// Multi-tenancy stays disabled: the route guard applies on its own.
+	auth := NewAuthClientWithOptions(server.URL,
+		WithHealthCheck(false),
+		WithLogger(&testLogger{}),
+		WithMultiTenant(MultiTenantConfig{Admins: []string{"platform"}}),
+	)
+
+	otherApplication := createTestJWT(jwt.MapClaims{"type": "application", "sub": "midaz-worker", "tenantId": "t-1"})
+
+	app := fiber.New()
+	app.Get("/tenants/:id/ledgers",
+		auth.Authorize("midaz", "ledgers", "get", WithTenantGuard(TenantSource{PathParam: "id", Header: "X-Target-Tenant"})),
+		func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) },
+	)
+
+	tests := []struct {
+		name       string
+		path       string
+		header     string
+		token      string
+		wantStatus int
+	}{
+		{name: "own_tenant", path: "/tenants/t-1/ledgers", token: token, wantStatus: http.StatusOK},
+		{name: "other_tenant_in_path", path: "/tenants/t-2/ledgers", token: token, wantStatus: http.StatusForbidden},
+		{name: "other_tenant_in_header", path: "/tenants/t-1/ledgers", header: "t-2", token: token, wantStatus: http.StatusForbidden},
+		{name: "admin", path: "/tenants/t-2/ledgers", header: "t-3", token: adminToken(), wantStatus: http.StatusOK},
+		{name: "other_application", path: "/tenants/t-2/ledgers", token: otherApplication, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			if tt.header != "" {
+				req.Header.Set("X-Target-Tenant", tt.header)
+			}
+
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestGRPCPolicies_TenantGuard(t *testing.T) {
+	t.Parallel()
+
+	token := createTestJWT(userClaims(tenantClaims))
+
+	server := mockAuthServer(t, true, http.StatusOK)
+	t.Cleanup(server.Close)
+
+	auth := NewAuthClientWithOptions(server.URL,
+		WithHealthCheck(false),
+		WithLogger(&testLogger{}),
+		WithMultiTenant(MultiTenantConfig{Admins: []string{"platform"}}),
+	)
+
+	cfg := PolicyConfig{
+		SubResolver: SubFromMetadata("md-product"),
+		DefaultPolicy: &Policy{
+			Resource:    "ledgers",
+			Action:      "get",
+			TenantGuard: &TenantSource{MetadataKey: "x-target-tenant", Field: "name"},
+		},
+	}
+
+	otherApplication := createTestJWT(jwt.MapClaims{"type": "application", "sub": "midaz-worker", "tenantId": "t-1"})
+
+	tests := []struct {
+		name     string
+		token    string
+		product  string
+		metadata string
+		field    string
+		wantCode codes.Code
+	}{
+		{name: "own_tenant_in_field", token: token, field: "t-1", wantCode: codes.OK},
+		{name: "other_tenant_in_field", token: token, field: "t-2", wantCode: codes.PermissionDenied},
+		{name: "metadata_cannot_mask_field", token: token, metadata: "t-1", field: "t-2", wantCode: codes.PermissionDenied},
+		{name: "other_tenant_in_metadata", token: token, metadata: "t-2", wantCode: codes.PermissionDenied},
+		{name: "admin", token: adminToken(), metadata: "t-2", field: "t-3", wantCode: codes.OK},
+		{name: "other_application", token: otherApplication, metadata: "t-2", wantCode: codes.PermissionDenied},
+		{name: "application_claiming_admin_product", token: otherApplication, product: "platform", metadata: "t-2", wantCode: codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			md := metadata.Pairs("authorization", "Bearer "+tt.token, "md-product", cmp.Or(tt.product, "midaz"))
+			if tt.metadata != "" {
+				md.Set("x-target-tenant", tt.metadata)
+			}
+
+			ctx := metadata.NewIncomingContext(context.Background(), md)
+
+			_, err := NewGRPCAuthUnaryPolicy(auth, cfg)(ctx, &typepb.Field{Name: tt.field}, &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Get"},
+				func(context.Context, any) (any, error) { return "ok", nil })
+			assert.Equal(t, tt.wantCode, status.Code(err))
+
+			if tt.field != "" {
+				return
+			}
+
+			// Streams have no request message at interception time; only the metadata is checked.
+			err = NewGRPCAuthStreamPolicy(auth, cfg)(nil, &fakeServerStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/pkg.Service/Stream"},
+				func(any, grpc.ServerStream) error { return nil })
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// withTenantMetadata
+// ---------------------------------------------------------------------------
+
+func TestWithTenantMetadata(t *testing.T) {
+	t.Parallel()
+
+	keys := MultiTenantConfig{}.withDefaults().MetadataKeys
+	incoming := metadata.NewIncomingContext(context.Background(), metadata.Pairs("md-tenant-id", "spoofed", "x-request-id", "req-1"))
+
+	ctx := withTenantMetadata(incoming, Tenant{ID: "t-1", Owner: "acme"}, keys)
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, []string{"t-1"}, md.Get("md-tenant-id"))
+	assert.Empty(t, md.Get("md-tenant-slug"))
+	assert.Equal(t, []string{"acme"}, md.Get("md-tenant-owner"))
+	assert.Equal(t, []string{"req-1"}, md.Get("x-request-id"))
+
+	tenant, ok := TenantFromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, Tenant{ID: "t-1", Owner: "acme"}, tenant)
+
+	original, _ := metadata.FromIncomingContext(incoming)
+	assert.Equal(t, []string{"spoofed"}, original.Get("md-tenant-id"), "the caller's metadata must not be mutated")
+
+	_, ok = TenantFromContext(withTenantMetadata(context.Background(), Tenant{}, keys))
+	assert.False(t, ok)
+}
@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/LerianStudio/lib-observability/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// tokenRefreshRatio is the fraction of a token's lifetime after which it is refreshed in the background.
+	tokenRefreshRatio = 0.8
+	// maxTokenExpirySkew bounds how early a cached token stops being handed out, absorbing clock skew
+	// and request latency.
+	maxTokenExpirySkew  = 10 * time.Second
+	tokenRefreshTimeout = 30 * time.Second
+)
+
+// TokenSource caches the application token of one client ID. The token is refreshed in the
+// background before it expires, with the refresh token when one was issued and with the client
+// credentials otherwise. Tokens issued without expiresIn are not cached. Safe for concurrent use.
+type TokenSource struct {
+	auth     *AuthClient
+	clientID string
+
+	mu           sync.Mutex
+	clientSecret string
+	token        *ApplicationToken
+	validUntil   time.Time
+	timer        *time.Timer
+	closed       bool
+
+	// fetches coalesces concurrent fetches, including the background refresh, into one request.
+	fetches singleflight.Group
+}
+
+// TokenSource returns the token source of clientID, creating it on first use. Sources are shared
+// per client ID, so every caller reuses the same cached token; a different clientSecret replaces
+// the stored one for subsequent fetches.
+func (auth *AuthClient) TokenSource(clientID, clientSecret string) *TokenSource {
+	auth.tokenSourcesMu.Lock()
+	defer auth.tokenSourcesMu.Unlock()
+
+	if ts, ok := auth.tokenSources[clientID]; ok {
+		ts.mu.Lock()
+		ts.clientSecret = clientSecret
+		ts.mu.Unlock()
+
+		return ts
+	}
+
+	if auth.tokenSources == nil {
+		auth.tokenSources = make(map[string]*TokenSource)
+	}
+
+	ts := &TokenSource{auth: auth, clientID: clientID, clientSecret: clientSecret}
+	auth.tokenSources[clientID] = ts
+
+	return ts
+}
+
+// Token returns a valid access token, fetching one when none is cached or the cached one is about
+// to expire. Disabled clients return an empty token, like GetApplicationToken.
+func (ts *TokenSource) Token(ctx context.Context) (string, error) {
+	if !ts.auth.Enabled || ts.auth.Address == "" {
+		return "", nil
+	}
+
+	ts.mu.Lock()
+	if ts.token != nil && time.Now().Before(ts.validUntil) {
+		accessToken := ts.token.AccessToken
+		ts.mu.Unlock()
+
+		return accessToken, nil
+	}
+	ts.mu.Unlock()
+
+	return ts.fetch(ctx)
+}
+
+// invalidate stops handing out accessToken when it is still the cached token, e.g. after the
+// server rejected it, so the next Token call fetches a new one.
+func (ts *TokenSource) invalidate(accessToken string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.token != nil && ts.token.AccessToken == accessToken {
+		ts.validUntil = time.Time{}
+	}
+}
+
+// Close stops background refreshes and detaches the source from its AuthClient, so the next
+// call to AuthClient.TokenSource for the same client ID starts afresh.
+func (ts *TokenSource) Close() {
+	ts.mu.Lock()
+	ts.closed = true
+
+	if ts.timer != nil {
+		ts.timer.Stop()
+		ts.timer = nil
+	}
+	ts.mu.Unlock()
+
+	ts.auth.tokenSourcesMu.Lock()
+	defer ts.auth.tokenSourcesMu.Unlock()
+
+	if ts.auth.tokenSources[ts.clientID] == ts {
+		delete(ts.auth.tokenSources, ts.clientID)
+	}
+}
+
+// fetch obtains a new token, sharing the request with concurrent callers. The shared request is
+// detached from the cancellation of the caller that started it.
+func (ts *TokenSource) fetch(ctx context.Context) (string, error) {
+	ch := ts.fetches.DoChan(ts.clientID, func() (any, error) {
+		fetchCtx, cancel := detachedContext(ctx)
+		defer cancel()
+
+		return ts.refresh(fetchCtx)
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return "", res.Err
+		}
+
+		accessToken, _ := res.Val.(string)
+
+		return accessToken, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// refresh requests a token with the refresh token when available, falling back to the client
+// credentials grant when there is none or it is rejected, and stores the result.
+func (ts *TokenSource) refresh(ctx context.Context) (string, error) {
+	tracer, reqID := ts.auth.tracking(ctx)
+
+	ctx, span := tracer.Start(ctx, "lib_auth.token_source.refresh")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("app.request.request_id", reqID),
+	)
+
+	ts.mu.Lock()
+	clientSecret := ts.clientSecret
+
+	var refreshToken string
+	if ts.token != nil {
+		refreshToken = ts.token.RefreshToken
+	}
+	ts.mu.Unlock()
+
+	var (
+		token *ApplicationToken
+		err   error
+	)
+
+	if refreshToken != "" {
+		token, err = ts.auth.RefreshApplicationToken(ctx, ts.clientID, clientSecret, refreshToken)
+
+		switch {
+		case err != nil:
+			logWarnf(ctx, ts.auth.Logger, "Failed to refresh application token for client %s, requesting a new one: %v", ts.clientID, err)
+		case token.RefreshToken == "":
+			// The refresh token was not rotated; keep using it.
+			token.RefreshToken = refreshToken
+		}
+	}
+
+	if token == nil {
+		token, err = ts.auth.GetApplicationTokenResponse(ctx, ts.clientID, clientSecret)
+		if err != nil {
+			tracing.HandleSpanError(span, "Failed to get application token", err)
+
+			return "", err
+		}
+	}
+
+	span.SetAttributes(attribute.Int("app.auth.token.expires_in", token.ExpiresIn))
+
+	ts.store(token)
+
+	return token.AccessToken, nil
+}
+
+// store caches token and schedules its background refresh at tokenRefreshRatio of its lifetime.
+func (ts *TokenSource) store(token *ApplicationToken) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.token = token
+	ts.validUntil = time.Time{}
+
+	if ts.timer != nil {
+		ts.timer.Stop()
+		ts.timer = nil
+	}
+
+	if token.ExpiresAt.IsZero() {
+		return
+	}
+
+	lifetime := time.Duration(token.ExpiresIn) * time.Second
+	refreshIn := time.Duration(float64(lifetime) * tokenRefreshRatio)
+	skew := min(maxTokenExpirySkew, (lifetime-refreshIn)/2)
+
+	ts.validUntil = token.ExpiresAt.Add(-skew)
+
+	if !ts.closed {
+		ts.timer = time.AfterFunc(refreshIn, ts.backgroundRefresh)
+	}
+}
+
+// backgroundRefresh renews the token ahead of expiry. On failure the cached token is kept and the
+// next Token call after it expires fetches a new one.
+func (ts *TokenSource) backgroundRefresh() {
+	ts.mu.Lock()
+	closed := ts.closed
+	ts.mu.Unlock()
+
+	if closed {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tokenRefreshTimeout)
+	defer cancel()
+
+	if _, err := ts.fetch(ctx); err != nil {
+		logErrorf(ctx, ts.auth.Logger, "Failed to refresh application token for client %s in the background: %v", ts.clientID, err)
+	}
+}
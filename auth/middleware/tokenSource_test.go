@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenServer issues "token-<n>" access tokens with the given lifetime and refresh token,
+// recording the grant type of every request. Refresh grants are rejected when rejectRefresh is set.
+type tokenServer struct {
+	*httptest.Server
+
+	expiresIn     int
+	refreshToken  string
+	rejectRefresh bool
+	delay         time.Duration
+
+	issued atomic.Int32
+	mu     sync.Mutex
+	grants []string
+}
+
+func newTokenServer(t *testing.T, expiresIn int, refreshToken string) *tokenServer {
+	t.Helper()
+
+	ts := &tokenServer{expiresIn: expiresIn, refreshToken: refreshToken}
+
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("token server: failed to decode request body: %v", err)
+		}
+
+		ts.mu.Lock()
+		ts.grants = append(ts.grants, body["grantType"])
+		ts.mu.Unlock()
+
+		time.Sleep(ts.delay)
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if body["grantType"] == "refresh_token" && (ts.rejectRefresh || body["refreshToken"] != ts.refreshToken) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"code":"AUT-0401","title":"Unauthorized","message":"invalid refresh token"}`))
+
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(oauth2Token{
+			AccessToken:  fmt.Sprintf("token-%d", ts.issued.Add(1)),
+			ExpiresIn:    ts.expiresIn,
+			RefreshToken: ts.refreshToken,
+		})
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func (ts *tokenServer) grantTypes() []string {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return append([]string(nil), ts.grants...)
+}
+
+func tokenClient(address string) *AuthClient {
+	return NewAuthClientWithOptions(address, WithHealthCheck(false), WithLogger(&testLogger{}))
+}
+
+// ---------------------------------------------------------------------------
+// TokenSource
+// ---------------------------------------------------------------------------
+
+func TestTokenSource_CachesToken(t *testing.T) {
+	t.Parallel()
+
+	server := newTokenServer(t, 3600, "")
+	auth := tokenClient(server.URL)
+
+	ts := auth.TokenSource("client", "secret")
+	t.Cleanup(ts.Close)
+
+	for range 3 {
+		token, err := ts.Token(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "token-1", token)
+	}
+
+	assert.Equal(t, []string{"client_credentials"}, server.grantTypes())
+}
+
+func TestTokenSource_SharedPerClientID(t *testing.T) {
+	t.Parallel()
+
+	auth := tokenClient("http://plugin-auth:4000")
+
+	first := auth.TokenSource("client-a", "secret")
+	t.Cleanup(first.Close)
+
+	other := auth.TokenSource("client-b", "secret")
+	t.Cleanup(other.Close)
+
+	assert.Same(t, first, auth.TokenSource("client-a", "rotated-secret"))
+	assert.NotSame(t, first, other)
+	assert.Equal(t, "rotated-secret", first.clientSecret)
+
+	first.Close()
+	assert.NotSame(t, first, auth.TokenSource("client-a", "secret"))
+}
+
+func TestTokenSource_ConcurrentCallersShareOneRequest(t *testing.T) {
+	t.Parallel()
+
+	server := newTokenServer(t, 3600, "")
+	server.delay = 50 * time.Millisecond
+
+	auth := tokenClient(server.URL)
+
+	ts := auth.TokenSource("client", "secret")
+	t.Cleanup(ts.Close)
+
+	var wg sync.WaitGroup
+
+	for range 20 {
+		wg.Go(func() {
+			token, err := ts.Token(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, "token-1", token)
+		})
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(1), server.issued.Load())
+}
+
+func TestTokenSource_ProactiveRefreshUsesRefreshToken(t *testing.T) {
+	t.Parallel()
+
+	server := newTokenServer(t, 1, "refresh-1")
+	auth := tokenClient(server.URL)
+
+	ts := auth.TokenSource("client", "secret")
+	t.Cleanup(ts.Close)
+
+	token, err := ts.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token)
+
+	// The background refresh runs at 80% of the 1s lifetime, before the token stops being served.
+	require.Eventually(t, func() bool {
+		return server.issued.Load() == 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	token, err = ts.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token)
+	assert.Equal(t, []string{"client_credentials", "refresh_token"}, server.grantTypes()[:2])
+}
+
+func TestTokenSource_RejectedRefreshFallsBackToClientCredentials(t *testing.T) {
+	t.Parallel()
+
+	server := newTokenServer(t, 1, "refresh-1")
+	server.rejectRefresh = true
+
+	auth := tokenClient(server.URL)
+
+	ts := auth.TokenSource("client", "secret")
+	t.Cleanup(ts.Close)
+
+	_, err := ts.Token(context.Background())
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return server.issued.Load() == 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, []string{"client_credentials", "refresh_token", "client_credentials"}, server.grantTypes()[:3])
+}
+
+func TestTokenSource_TokenWithoutExpiryIsNotCached(t *testing.T) {
+	t.Parallel()
+
+	server := newTokenServer(t, 0, "")
+	auth := tokenClient(server.URL)
+
+	ts := auth.TokenSource("client", "secret")
+	t.Cleanup(ts.Close)
+
+	first, err := ts.Token(context.Background())
+	require.NoError(t, err)
+
+	second, err := ts.Token(context.Background())
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, int32(2), server.issued.Load())
+}
+
+func TestTokenSource_CloseStopsBackgroundRefresh(t *testing.T) {
+	t.Parallel()
+
+	server := newTokenServer(t, 1, "")
+	auth := tokenClient(server.URL)
+
+	ts := auth.TokenSource("client", "secret")
+
+	_, err := ts.Token(context.Background())
+	require.NoError(t, err)
+
+	ts.Close()
+
+	time.Sleep(1200 * time.Millisecond)
+
+	assert.Equal(t, int32(1), server.issued.Load())
+}
+
+func TestTokenSource_DisabledClient(t *testing.T) {
+	t.Parallel()
+
+	auth := NewAuthClientWithOptions("http://plugin-auth:4000", WithEnabled(false), WithLogger(&testLogger{}))
+
+	token, err := auth.TokenSource("client", "secret").Token(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, token)
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// TokenTransport is an http.RoundTripper that authenticates outgoing requests with the
+// application token of a TokenSource. Requests rejected with 401 are retried once with a
+// freshly fetched token when their body can be replayed.
+type TokenTransport struct {
+	source *TokenSource
+	base   http.RoundTripper
+}
+
+// NewTokenTransport wraps base, or http.DefaultTransport when nil, so every request carries
+// "Authorization: Bearer <token>" from source:
+//
+//	client := &http.Client{Transport: middleware.NewTokenTransport(authClient.TokenSource(id, secret), nil)}
+func NewTokenTransport(source *TokenSource, base http.RoundTripper) *TokenTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &TokenTransport{source: source, base: base}
+}
+
+// RoundTrip implements http.RoundTripper. The caller's request is never modified. When the
+// AuthClient is disabled, requests are sent without an Authorization header.
+func (t *TokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	token, err := t.source.Token(ctx)
+	if err != nil {
+		closeRequestBody(req)
+
+		return nil, fmt.Errorf("failed to get application token: %w", err)
+	}
+
+	if token == "" {
+		return t.base.RoundTrip(req)
+	}
+
+	resp, err := t.base.RoundTrip(withBearer(req, token, req.Body))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		// The body was consumed and cannot be replayed; surface the 401.
+		return resp, nil
+	}
+
+	t.source.invalidate(token)
+
+	freshToken, err := t.source.Token(ctx)
+	if err != nil {
+		// Keep the original 401 rather than masking it with the token error.
+		return resp, nil
+	}
+
+	body := req.Body
+	if req.GetBody != nil {
+		if body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return t.base.RoundTrip(withBearer(req, freshToken, body))
+}
+
+// CloseIdleConnections closes idle connections of the underlying transport, when supported.
+func (t *TokenTransport) CloseIdleConnections() {
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// withBearer returns a copy of req with body and the bearer token set.
+func withBearer(req *http.Request, token string, body io.ReadCloser) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Body = body
+	clone.Header.Set("Authorization", "Bearer "+token)
+
+	return clone
+}
+
+// closeRequestBody honors the RoundTripper contract of closing the body, even on errors.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
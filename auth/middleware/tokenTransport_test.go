@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// protectedServer records the Authorization header and body of every request and answers 401
+// while the bearer token is in rejected.
+type protectedServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	rejected map[string]bool
+	headers  []string
+	bodies   []string
+}
+
+func newProtectedServer(t *testing.T, rejected ...string) *protectedServer {
+	t.Helper()
+
+	ps := &protectedServer{rejected: map[string]bool{}}
+	for _, token := range rejected {
+		ps.rejected["Bearer "+token] = true
+	}
+
+	ps.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		ps.mu.Lock()
+		defer ps.mu.Unlock()
+
+		header := r.Header.Get("Authorization")
+		ps.headers = append(ps.headers, header)
+		ps.bodies = append(ps.bodies, string(body))
+
+		if ps.rejected[header] {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(ps.Close)
+
+	return ps
+}
+
+func (ps *protectedServer) seen() ([]string, []string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	return append([]string(nil), ps.headers...), append([]string(nil), ps.bodies...)
+}
+
+// ---------------------------------------------------------------------------
+// TokenTransport
+// ---------------------------------------------------------------------------
+
+func TestTokenTransport_InjectsBearerToken(t *testing.T) {
+	t.Parallel()
+
+	tokens := newTokenServer(t, 3600, "")
+	target := newProtectedServer(t)
+
+	source := tokenClient(tokens.URL).TokenSource("client", "secret")
+	t.Cleanup(source.Close)
+
+	client := &http.Client{Transport: NewTokenTransport(source, nil)}
+
+	req, err := http.NewRequest(http.MethodGet, target.URL, nil)
+	require.NoError(t, err)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, req.Header.Get("Authorization"), "the caller's request must not be modified")
+
+	headers, _ := target.seen()
+	assert.Equal(t, []string{"Bearer token-1"}, headers)
+}
+
+func TestTokenTransport_RetriesOnceOnUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		rejected    []string
+		wantStatus  int
+		wantHeaders []string
+	}{
+		{
+			name:        "fresh_token_accepted",
+			rejected:    []string{"token-1"},
+			wantStatus:  http.StatusOK,
+			wantHeaders: []string{"Bearer token-1", "Bearer token-2"},
+		},
+		{
+			name:        "fresh_token_rejected",
+			rejected:    []string{"token-1", "token-2"},
+			wantStatus:  http.StatusUnauthorized,
+			wantHeaders: []string{"Bearer token-1", "Bearer token-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tokens := newTokenServer(t, 3600, "")
+			target := newProtectedServer(t, tt.rejected...)
+
+			source := tokenClient(tokens.URL).TokenSource("client", "secret")
+			t.Cleanup(source.Close)
+
+			client := &http.Client{Transport: NewTokenTransport(source, nil)}
+
+			req, err := http.NewRequest(http.MethodPost, target.URL, strings.NewReader("payload"))
+			require.NoError(t, err)
+
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+
+			headers, bodies := target.seen()
+			assert.Equal(t, tt.wantHeaders, headers)
+			assert.Equal(t, []string{"payload", "payload"}, bodies, "the body must be replayed on retry")
+		})
+	}
+}
+
+func TestTokenTransport_DoesNotRetryUnreplayableBody(t *testing.T) {
+	t.Parallel()
+
+	tokens := newTokenServer(t, 3600, "")
+	target := newProtectedServer(t, "token-1")
+
+	source := tokenClient(tokens.URL).TokenSource("client", "secret")
+	t.Cleanup(source.Close)
+
+	req, err := http.NewRequest(http.MethodPost, target.URL, io.NopCloser(strings.NewReader("payload")))
+	require.NoError(t, err)
+	require.Nil(t, req.GetBody)
+
+	resp, err := NewTokenTransport(source, nil).RoundTrip(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	headers, _ := target.seen()
+	assert.Len(t, headers, 1)
+}
+
+func TestTokenTransport_TokenError(t *testing.T) {
+	t.Parallel()
+
+	tokens := newTokenServer(t, 3600, "")
+	tokens.Close()
+
+	target := newProtectedServer(t)
+
+	source := tokenClient(tokens.URL).TokenSource("client", "secret")
+	t.Cleanup(source.Close)
+
+	client := &http.Client{Transport: NewTokenTransport(source, nil)}
+
+	resp, err := client.Get(target.URL)
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to get application token")
+
+	headers, _ := target.seen()
+	assert.Empty(t, headers)
+}
+
+func TestTokenTransport_DisabledClient(t *testing.T) {
+	t.Parallel()
+
+	target := newProtectedServer(t)
+
+	auth := NewAuthClientWithOptions("http://plugin-auth:4000", WithEnabled(false), WithLogger(&testLogger{}))
+	client := &http.Client{Transport: NewTokenTransport(auth.TokenSource("client", "secret"), nil)}
+
+	resp, err := client.Get(target.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	headers, _ := target.seen()
+	assert.Equal(t, []string{""}, headers)
+}
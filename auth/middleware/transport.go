@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultHTTPTimeout         = 30 * time.Second
+	defaultDialTimeout         = 10 * time.Second
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 10
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
+// ConnectionStats is a snapshot of an AuthClient's connection usage, for diagnostics.
+// OpenConnections and Dials are only tracked for the client's own transport; with a
+// custom client set through WithHTTPClient they stay at zero.
+type ConnectionStats struct {
+	// OpenConnections is the number of connections currently open, idle or in use.
+	OpenConnections int64
+	// Dials is the number of connections dialed since the client was created.
+	Dials int64
+	// Requests is the number of requests that obtained a connection.
+	Requests int64
+	// ReusedConnections is the number of requests served over an already open connection.
+	ReusedConnections int64
+}
+
+// connStats holds the live counters behind ConnectionStats.
+type connStats struct {
+	open     atomic.Int64
+	dials    atomic.Int64
+	requests atomic.Int64
+	reused   atomic.Int64
+}
+
+// newHTTPClient builds an HTTP client with its own connection pool. HTTP/2 is disabled to
+// prevent hpack panics under concurrent access. When stats is non-nil, dialed and open
+// connections are counted.
+func newHTTPClient(timeout time.Duration, stats *connStats) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   defaultDialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	dial := dialer.DialContext
+	if stats != nil {
+		dial = stats.dialContext(dialer.DialContext)
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         dial,
+			ForceAttemptHTTP2:   false,
+			MaxIdleConns:        defaultMaxIdleConns,
+			MaxIdleConnsPerHost: defaultMaxIdleConnsPerHost,
+			IdleConnTimeout:     defaultIdleConnTimeout,
+			TLSHandshakeTimeout: defaultDialTimeout,
+		},
+	}
+}
+
+// dialContext wraps dial so every connection is counted when opened and when closed.
+func (s *connStats) dialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		s.dials.Add(1)
+		s.open.Add(1)
+
+		return &countedConn{Conn: conn, stats: s}, nil
+	}
+}
+
+// countedConn decrements the open connection counter exactly once on Close.
+type countedConn struct {
+	net.Conn
+	stats *connStats
+	once  sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.stats.open.Add(-1) })
+
+	return c.Conn.Close()
+}
+
+// client returns the HTTP client of this AuthClient. Clients built without NewAuthClientWithOptions
+// (e.g. as struct literals) lazily get their own pooled client on first use.
+func (auth *AuthClient) client() *http.Client {
+	auth.clientOnce.Do(func() {
+		if auth.httpClient == nil {
+			auth.httpClient = newHTTPClient(defaultHTTPTimeout, &auth.connStats)
+		}
+	})
+
+	return auth.httpClient
+}
+
+// newRequest creates an HTTP request bound to ctx, so the caller's deadline and cancellation
+// apply, and traced so connection reuse is reflected in ConnectionStats.
+func (auth *AuthClient) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			auth.connStats.requests.Add(1)
+
+			if info.Reused {
+				auth.connStats.reused.Add(1)
+			}
+		},
+	})
+
+	return http.NewRequestWithContext(ctx, method, url, body)
+}
+
+// ConnectionStats returns a snapshot of the client's connection usage.
+func (auth *AuthClient) ConnectionStats() ConnectionStats {
+	return ConnectionStats{
+		OpenConnections:   auth.connStats.open.Load(),
+		Dials:             auth.connStats.dials.Load(),
+		Requests:          auth.connStats.requests.Load(),
+		ReusedConnections: auth.connStats.reused.Load(),
+	}
+}
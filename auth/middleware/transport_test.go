@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthClient_OwnsItsTransport(t *testing.T) {
+	t.Parallel()
+
+	first := &AuthClient{Address: "http://a", Enabled: true}
+	second := &AuthClient{Address: "http://b", Enabled: true}
+
+	require.NotNil(t, first.client())
+	assert.Same(t, first.client(), first.client())
+	assert.NotSame(t, first.client().Transport, second.client().Transport)
+
+	transport, ok := first.client().Transport.(*http.Transport)
+	require.True(t, ok)
+	assert.False(t, transport.ForceAttemptHTTP2)
+	assert.Equal(t, defaultHTTPTimeout, first.client().Timeout)
+}
+
+func TestAuthClient_ConnectionStats(t *testing.T) {
+	t.Parallel()
+
+	server := mockAuthServer(t, true, http.StatusOK)
+	defer server.Close()
+
+	auth := &AuthClient{
+		Address: server.URL,
+		Enabled: true,
+		Logger:  &testLogger{},
+	}
+
+	token := createTestJWT(jwt.MapClaims{"type": "normal-user", "owner": "org1", "sub": "user1"})
+
+	for _, action := range []string{"get", "post"} {
+		_, _, err := auth.checkAuthorization(context.Background(), "midaz", "ledgers", action, token)
+		require.NoError(t, err)
+	}
+
+	stats := auth.ConnectionStats()
+	assert.Equal(t, int64(1), stats.Dials)
+	assert.Equal(t, int64(1), stats.OpenConnections)
+	assert.Equal(t, int64(2), stats.Requests)
+	assert.Equal(t, int64(1), stats.ReusedConnections)
+
+	auth.client().CloseIdleConnections()
+
+	assert.Eventually(t, func() bool { return auth.ConnectionStats().OpenConnections == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestCheckAuthorization_HonoursContextDeadline(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+
+		_ = json.NewEncoder(w).Encode(AuthResponse{Authorized: true})
+	}))
+	defer server.Close()
+	defer close(release)
+
+	auth := &AuthClient{
+		Address: server.URL,
+		Enabled: true,
+		Logger:  &testLogger{},
+	}
+
+	token := createTestJWT(jwt.MapClaims{"type": "normal-user", "owner": "org1", "sub": "user1"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	authorized, statusCode, err := auth.checkAuthorization(ctx, "midaz", "ledgers", "get", token)
+	require.Error(t, err)
+	assert.False(t, authorized)
+	assert.Equal(t, http.StatusInternalServerError, statusCode)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}